@@ -0,0 +1,194 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidConfig is an error which is returned when a config file can't be parsed or sets an unknown flag.
+var ErrInvalidConfig = errors.New("invalid config file")
+
+// configSetting is a flag set by a line of a config file.
+// Repeatable flags are set once for each of the values.
+type configSetting struct {
+	Name   string
+	Values []string
+	Line   int
+}
+
+// ApplyConfigFile sets the flags in fs from the TOML config file at path.
+// Flags which were already set on the command line are left alone, so they override the file.
+// Only the flat part of TOML is supported: key = value lines, with strings, numbers, booleans, and arrays of them.
+func ApplyConfigFile(fs *flag.FlagSet, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	settings, err := parseConfigFile(f)
+	if err != nil {
+		return fmt.Errorf("reading config file '%v' failed, %w", path, err)
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for _, s := range settings {
+		if s.Name == "config" {
+			return fmt.Errorf("reading config file '%v' failed, %w: line %v, a config file can't load another",
+				path, ErrInvalidConfig, s.Line)
+		}
+
+		if fs.Lookup(s.Name) == nil {
+			return fmt.Errorf("reading config file '%v' failed, %w: line %v sets unknown flag '%v'",
+				path, ErrInvalidConfig, s.Line, s.Name)
+		}
+
+		if set[s.Name] {
+			continue
+		}
+
+		for _, v := range s.Values {
+			err := fs.Set(s.Name, v)
+			if err != nil {
+				return fmt.Errorf("reading config file '%v' failed, %w: line %v: %v", path, ErrInvalidConfig, s.Line, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseConfigFile reads the key = value lines of a config file. Blank lines and comments are skipped.
+func parseConfigFile(r io.Reader) ([]configSetting, error) {
+	settings := []configSetting{}
+	seen := map[string]bool{}
+
+	scanner := bufio.NewScanner(r)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if lineNum == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("%w: line %v starts a table, which isn't supported", ErrInvalidConfig, lineNum)
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%w: line %v is not in the form key = value", ErrInvalidConfig, lineNum)
+		}
+
+		if seen[key] {
+			return nil, fmt.Errorf("%w: '%v' is set again on line %v", ErrInvalidConfig, key, lineNum)
+		}
+
+		seen[key] = true
+
+		values, rest, err := parseConfigValue(strings.TrimSpace(value), true)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %v: %v", ErrInvalidConfig, lineNum, err)
+		}
+
+		if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("%w: line %v has '%v' after the value", ErrInvalidConfig, lineNum, rest)
+		}
+
+		settings = append(settings, configSetting{Name: key, Values: values, Line: lineNum})
+	}
+
+	return settings, scanner.Err()
+}
+
+// parseConfigValue parses the value at the start of s, and returns the text after it.
+// Arrays are only allowed if array is true, so they can't be nested.
+func parseConfigValue(s string, array bool) ([]string, string, error) {
+	switch {
+	case s == "":
+		return nil, "", errors.New("missing value")
+	case s[0] == '"':
+		// Basic strings use the same escapes as Go strings.
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+				continue
+			}
+
+			if s[i] == '"' {
+				v, err := strconv.Unquote(s[:i+1])
+				if err != nil {
+					return nil, "", fmt.Errorf("invalid string %v", s[:i+1])
+				}
+
+				return []string{v}, s[i+1:], nil
+			}
+		}
+
+		return nil, "", errors.New("unterminated string")
+	case s[0] == '\'':
+		// Literal strings have no escapes.
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return nil, "", errors.New("unterminated string")
+		}
+
+		return []string{s[1 : end+1]}, s[end+2:], nil
+	case s[0] == '[' && array:
+		values := []string{}
+		rest := strings.TrimSpace(s[1:])
+
+		for !strings.HasPrefix(rest, "]") {
+			v, r, err := parseConfigValue(rest, false)
+			if err != nil {
+				return nil, "", err
+			}
+
+			values = append(values, v...)
+			rest = strings.TrimSpace(r)
+
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, "", errors.New("unterminated array")
+			}
+		}
+
+		return values, rest[1:], nil
+	case s[0] == '[':
+		return nil, "", errors.New("arrays can't be nested")
+	}
+
+	// Bare values, like numbers and booleans, end at whitespace, a comma, the end of an array, or a comment.
+	end := strings.IndexAny(s, " \t,]#")
+	if end < 0 {
+		end = len(s)
+	}
+
+	if end == 0 {
+		return nil, "", fmt.Errorf("missing value before '%v'", s)
+	}
+
+	return []string{s[:end]}, s[end:], nil
+}
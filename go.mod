@@ -1,5 +1,12 @@
 module github.com/cu-library/hours2drupal
 
-go 1.16
+go 1.21
 
-require golang.org/x/term v0.0.0-20210406210042-72f3dc4e9b72
+require (
+	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
+	golang.org/x/term v0.0.0-20210406210042-72f3dc4e9b72
+	golang.org/x/text v0.3.6
+	golang.org/x/time v0.10.0
+)
+
+require golang.org/x/sys v0.0.0-20210330210617-4fbd30eecc44 // indirect
@@ -7,482 +7,1123 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
 	"context"
-	"encoding/csv"
-	"encoding/json"
+	"crypto/x509"
+	"encoding/base64"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"strings"
 	"time"
 
+	"github.com/cu-library/hours2drupal/pkg/hours2drupal"
 	"golang.org/x/term"
 )
 
-const (
-	// ProjectName is the name of the executable, as displayed to the user in usage and version messages.
-	ProjectName = "hours2drupal"
-	// Version  is the version number, which should be overwritten when building using ldflags.
-	Version = "devel"
-	// HoursPath is the path to append to the target to build the full URL for Hours nodes.
-	HoursPath = "/jsonapi/node/hours"
-	// HoursByDayPath is the path to append to the target to build the full URL for hours_by_day paragraphs.
-	HoursByDayPath = "/jsonapi/paragraph/hours_by_day"
-	// RequestTimeout is the amount of time the tool will wait for API calls to complete before they are cancelled.
-	RequestTimeout = 60 * time.Second
-	// AcceptHeader is the MIME type Drupal's JSON API expects to see in the Accept header of POST requests.
-	AcceptHeader = "application/vnd.api+json"
-	// ContentTypeHeader is the MIME type Drupal's JSON API expects to see in the Content-Type header of POST requests.
-	ContentTypeHeader = "application/vnd.api+json"
-)
+// errTargetsFailed is returned when the import into one or more of the targets failed.
+var errTargetsFailed = errors.New("the import failed")
+
+// errDiagnosisFailed is returned when one of the diagnostic checks fails. The checks report their own failures.
+var errDiagnosisFailed = errors.New("the diagnostic checks failed")
 
-// ErrNoHeader is an error which is returned when a CSV file doesn't have a header line.
-var ErrNoHeader = errors.New("csv file did not have a header")
-
-// ErrMissingData is an error which is returned when a CSV file has missing fields.
-var ErrMissingData = errors.New("missing data")
-
-// ErrAPIError is an error which is returned when the Drupal API returns an unexpected error.
-var ErrAPIError = errors.New("an API error occurred")
-
-// HoursByDayParagraph is the struct compliment of the required JSON for an hours by day paragraph.
-type HoursByDayParagraph struct {
-	Data struct {
-		Type       string `json:"type"`
-		ID         string `json:"id,omitempty"`
-		Attributes struct {
-			DrupalInternalID         int    `json:"drupal_internal__id,omitempty"`
-			DrupalInternalRevisionID int    `json:"drupal_internal__revision_id,omitempty"`
-			ParentID                 string `json:"parent_id"`
-			ParentType               string `json:"parent_type"`
-			ParentFieldName          string `json:"parent_field_name"`
-			BuildingHours            string `json:"field_building_hours"`
-			ChatHours                string `json:"field_chat_hours"`
-			Day                      string `json:"field_day"`
-			Note                     string `json:"field_note"`
-		} `json:"attributes"`
-	} `json:"data"`
+// reportedError is an error which has already been reported to the user, so it isn't printed again.
+type reportedError struct {
+	err error
 }
 
-// NewHoursByDayParagraph creates a new NewHoursByDayParagraph struct.
-func NewHoursByDayParagraph(parentID, buildingHours, chatHours, day, note string) HoursByDayParagraph {
-	p := HoursByDayParagraph{}
-	p.Data.Type = "paragraph--hours_by_day"
-	p.Data.Attributes.ParentID = parentID
-	p.Data.Attributes.ParentType = "node"
-	p.Data.Attributes.ParentFieldName = "field_day"
-	p.Data.Attributes.BuildingHours = strings.TrimSpace(buildingHours)
-	p.Data.Attributes.ChatHours = strings.TrimSpace(chatHours)
-	p.Data.Attributes.Day = strings.TrimSpace(day)
-	p.Data.Attributes.Note = strings.TrimSpace(note)
-
-	return p
+func (e reportedError) Error() string {
+	return e.err.Error()
 }
 
-// Post uses the JSON API endpoint at target to create the new paragraph.
-func (p *HoursByDayParagraph) Post(ctx context.Context, target, username, password string) error {
-	url := fmt.Sprintf("https://%v%v", target, HoursByDayPath)
-	return p.doAPICall(ctx, url, http.MethodPost, username, password)
+func (e reportedError) Unwrap() error {
+	return e.err
 }
 
-// doAPICall calls the API using the provided method.
-func (p *HoursByDayParagraph) doAPICall(ctx context.Context, url, method, username, password string) error {
-	// Create a new context from the base context with a timeout.
-	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
-	defer cancel()
+// DefaultTarget is the server hours are sent to if -target isn't set.
+const DefaultTarget = "library.carleton.ca"
 
-	b, err := json.Marshal(p)
-	if err != nil {
-		return err
+// Version  is the version number, which should be overwritten when building using ldflags.
+const Version = "devel"
+
+func main() {
+	// Set the prefix of the default logger to the empty string.
+	log.SetFlags(0)
+
+	err := run()
+	if err == nil {
+		return
 	}
 
-	r, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(b))
-	if err != nil {
-		return err
+	// A failed import has already been reported, along with the offer to roll it back.
+	reported := reportedError{}
+	if !errors.As(err, &reported) {
+		log.Printf("Error: %v.\n", err)
 	}
 
-	// Set the required headers.
-	r.Header.Set("Accept", AcceptHeader)
-	r.Header.Set("Content-Type", ContentTypeHeader)
-	r.SetBasicAuth(username, password)
+	os.Exit(1)
+}
 
-	// Do the POST request.
-	resp, err := http.DefaultClient.Do(r)
-	if err != nil {
-		return err
+// run parses the flags, then runs the diagnostics, export, deletion, or import they ask for.
+// Errors are returned rather than exiting, so deferred cleanup runs and main is the only place that exits.
+func run() error {
+	// Define the command line flags.
+	targets := TargetFlags{}
+	flag.Var(&targets, "target", "The name of the server to POST hours to. Defaults to "+DefaultTarget+
+		". Repeat it to import into more than one target, and use username@server to give a target its own username.")
+	defaultUsername := hours2drupal.DefaultUsername
+	if u := os.Getenv(hours2drupal.UsernameEnvVar); u != "" {
+		defaultUsername = u
 	}
 
-	// If the response is 200 or 201, update the node.
-	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
-		rb, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return err
-		}
+	username := flag.String("username", defaultUsername,
+		"The username to use when authenticating with the target. Defaults to the "+hours2drupal.UsernameEnvVar+
+			" environment variable, if it is set.")
+	fieldDayIsRelationship := flag.Bool("field-day-is-relationship", false,
+		"Omit the day from the paragraph, for content models where the day is handled elsewhere.")
+	inputAuth := flag.String("input-auth", "", "The optional username:password to use when fetching CSV files from a URL.")
+	minMonthDays := flag.Int("min-month-days", 2,
+		"Warn about months with fewer than this many days when importing more than one month, "+
+			"which usually means a date was mistyped. Only applies to -group-by month. An error with -strict. Zero disables the check.")
+	maxDays := flag.Int("max-days", 0, "Ask for confirmation before importing more than this many days. Zero means no limit.")
+	metricsPushgateway := flag.String("metrics-pushgateway", "",
+		"The URL of a Prometheus Pushgateway to push run metrics to.")
+	paragraphBatchSize := flag.Int("paragraph-batch-size", 1,
+		"The number of paragraphs to create with each request, if the target supports it.")
+	fieldName := flag.String("field-name", "field_day",
+		"The machine name of the paragraph reference field, used for both -node-field-name and -parent-field-name.")
+	nodeFieldName := flag.String("node-field-name", "field_day",
+		"The machine name of the hours node's field which references the paragraphs.")
+	parentFieldName := flag.String("parent-field-name", "field_day",
+		"The machine name of the parent field recorded on each paragraph.")
+	fieldMapFile := flag.String("field-map-file", "",
+		"A JSON file describing the content model and how the CSV columns map onto it.")
+	strictFields := flag.Bool("strict-fields", false,
+		"Require the node field name and the paragraph parent field name to match.")
+	minTLSVersion := flag.String("min-tls-version", "1.2", "The lowest TLS version to accept: 1.0, 1.1, 1.2, or 1.3.")
+	sanitizeNotes := flag.Bool("sanitize-notes", false, "Remove disallowed HTML from notes before posting.")
+	allowedNoteTags := flag.String("allowed-note-tags", hours2drupal.DefaultAllowedNoteTags,
+		"A comma separated list of HTML tags to keep when sanitizing notes.")
+	expectContinue := flag.Bool("expect-continue", false,
+		"Send 'Expect: 100-continue' and wait for the server before sending request bodies.")
+	strictRelationships := flag.Bool("strict-relationships", false,
+		"Fail if the target drops any of the paragraph relationships patched into a node.")
+	sample := flag.Bool("dry-run-sample", false,
+		"Create only one sample day per month, so the result can be checked on the target before a full import.")
+	truncateTitle := flag.Bool("truncate-title", false,
+		"Shorten node titles longer than 255 characters with an ellipsis, instead of failing.")
+	canonicalOut := flag.String("canonical-out", "",
+		"Write the normalized hours to this CSV file, using the standard column headers.")
+	dateLayout := flag.String("date-format", hours2drupal.DefaultDateLayout,
+		"The Go time layout of the days in the day column, like 01/02/2006 or 02-Jan-2006.")
+	timezone := flag.String("timezone", "",
+		"The IANA name of the time zone the days are in, like America/Toronto. Defaults to the local time zone.")
+	detectDateLayout := flag.Bool("detect-date-format", false,
+		"Detect the date format of each file from a sample of its days.")
+	dateLayouts := flag.String("date-format-candidates", hours2drupal.DefaultDateLayouts,
+		"A semicolon separated list of Go time layouts to try when detecting the date format.")
+	paragraphsOnly := flag.Bool("paragraphs-only", false,
+		"Attach paragraphs to existing nodes, found by title or -node-ids-file, instead of creating nodes.")
+	nodeIDsFile := flag.String("node-ids-file", "",
+		"A JSON file mapping node titles to existing node IDs, for -paragraphs-only.")
+	trace := flag.Bool("trace", false, "Log DNS, connect, TLS, and time to first byte durations for every request.")
+	useETag := flag.Bool("use-etag", false,
+		"Send If-Match with the node's ETag when patching, retrying with a fresh copy if the node changed.")
+	ignoreUnnamedColumns := flag.Bool("ignore-unnamed-columns", false,
+		"Skip CSV columns with an empty header, instead of failing.")
+	updateFields := flag.String("update-fields", "",
+		"With -update, a comma separated list of the paragraph fields, like \"note\", to patch in the existing "+
+			"paragraphs instead of replacing them. Empty means all fields are replaced.")
+	delimiter := flag.String("delimiter", ",", `The character which separates the fields of the CSV files, like ";". Use \t for tabs.`)
+	comment := flag.String("comment", "#", "Skip CSV lines which start with this character. Empty doesn't skip any lines.")
+	inputEncoding := flag.String("input-encoding", "utf-8",
+		"The encoding of the CSV files: utf-8, windows-1252, iso-8859-1 (latin1), or iso-8859-15.")
+	attemptOrder := flag.String("attempt-order", string(hours2drupal.AttemptOrderBulk),
+		"How to sequence creating each month's node and paragraphs: incremental, bulk, or paragraphs-first.")
+	planOut := flag.String("plan-out", "",
+		"Write a plan of the changes to this file for review, instead of importing. The target is read, but not written to.")
+	methodOverride := flag.Bool("method-override", false,
+		"Send PATCH and DELETE requests as POST requests with an X-HTTP-Method-Override header.")
+	sparse := flag.Bool("sparse", false,
+		"Request only the fields the tool needs in the responses to POST and PATCH requests.")
+	manifestOut := flag.String("manifest-out", "",
+		"If the import fails, write a manifest of the days which weren't imported to this file.")
+	reimportManifest := flag.String("reimport-manifest", "",
+		"Import the days in a manifest written by a failed import with -manifest-out.")
+	breakerThreshold := flag.Int("breaker-threshold", 0,
+		"Pause requests after this many consecutive server errors from the target. Zero disables the circuit breaker.")
+	breakerCooldown := flag.Duration("breaker-cooldown", 0,
+		"How long to pause requests once the circuit breaker trips. Zero aborts the import instead.")
+	structuredHoursLayout := flag.String("structured-hours-layout", "",
+		"Parse building hours like \"9:00am - 5:00pm\" into open and close times posted to their own fields, "+
+			"using this Go time layout, like \"3:04pm\", for each time.")
+	redact := flag.Bool("redact", true,
+		"Hide the password, credentials, and the values of sensitive headers in all output.")
+	redactHeaders := flag.String("redact-header", "",
+		"A comma separated list of additional headers whose values are hidden in output. "+
+			"The "+hours2drupal.DefaultRedactedHeaders+" headers are always hidden.")
+	weekTemplate := flag.String("week-template", "",
+		"A CSV file of the hours for each day of the week, used to fill every day in -range.")
+	dateRange := flag.String("range", "",
+		"The days to fill from -week-template, in the form 2006-01-02:2006-01-31.")
+	dryRunFlag := flag.Bool("dry-run", false,
+		"Load and validate the input, printing the JSON which would be sent instead of changing the target.")
+	hoursPath := flag.String("hours-path", hours2drupal.HoursPath,
+		"The path to append to the target to build the full URL for hours nodes.")
+	hoursByDayPath := flag.String("hours-by-day-path", hours2drupal.HoursByDayPath,
+		"The path to append to the target to build the full URL for hours by day paragraphs.")
+	scheme := flag.String("scheme", "https",
+		"The URL scheme used to reach the target, http or https. Use http only for local development.")
+	concurrency := flag.Int("concurrency", 1,
+		"The number of paragraphs of a month to create at the same time.")
+	maxRetries := flag.Int("max-retries", 3,
+		"The number of times to retry requests which fail with a 429, 502, 503, or 504 response, time out, "+
+			"or can't connect. A POST is only retried if it can't connect, or on a 429 or 503 response with Retry-After.")
+	bearerToken := flag.String("bearer-token", "",
+		"An OAuth2 bearer token to authenticate with instead of the username and password. "+
+			"Also read from the "+hours2drupal.TokenEnvVar+" environment variable.")
+	apiKey := flag.String("api-key", "",
+		"An API key to authenticate with instead of the username and password, sent in the -api-key-header header. "+
+			"Also read from the "+hours2drupal.APIKeyEnvVar+" environment variable.")
+	apiKeyHeader := flag.String("api-key-header", hours2drupal.DefaultAPIKeyHeader,
+		"The header the -api-key is sent in.")
+	timeout := flag.Duration("timeout", hours2drupal.RequestTimeout,
+		"How long to wait for each request to complete before cancelling it, like 90s or 2m.")
+	skipExisting := flag.Bool("skip-existing", false,
+		"Skip months which already have a node with the same title. Without it, a warning is printed and "+
+			"a duplicate node is created.")
+	update := flag.Bool("update", false,
+		"Replace the paragraphs of months which already have a node, instead of creating a new node.")
+	colDay := flag.String("col-day", hours2drupal.DefaultFieldMap().Columns.Day,
+		"The CSV header of the day column. Overrides the field map.")
+	colNote := flag.String("col-note", hours2drupal.DefaultFieldMap().Columns.Note,
+		"The CSV header of the note column. Overrides the field map.")
+	colBuilding := flag.String("col-building", hours2drupal.DefaultFieldMap().Columns.BuildingHours,
+		"The CSV header of the building hours column. Overrides the field map.")
+	groupBy := flag.String("group-by", string(hours2drupal.GroupByMonth),
+		"How the days are partitioned into nodes, month or week. Weekly nodes are titled like \"Week of 2025-01-06\".")
+	titleFormat := flag.String("title-format", hours2drupal.DefaultFieldMap().TitleFormat,
+		"The Go time layout used to build each month's node title, or a template with the layout in braces, "+
+			"like \"Hours - {January 2006}\". Overrides the field map.")
+	colChat := flag.String("col-chat", hours2drupal.DefaultFieldMap().Columns.ChatHours,
+		"The CSV header of the chat hours column. Overrides the field map.")
+	rollbackOnError := flag.Bool("rollback-on-error", false,
+		"If the import fails or is interrupted, offer to delete the nodes and paragraphs it created.")
+	logFormat := flag.String("log-format", hours2drupal.LogFormatText,
+		"The format of the output, text or json. The json format writes a structured log line for each step of the import.")
+	strictHours := flag.Bool("strict-hours", false,
+		"Reject building and chat hours which aren't like \"9:00am - 5:00pm\", \"Closed\", or \"24 Hours\".")
+	verbose := flag.Bool("verbose", false,
+		"Log every request sent to the target, and its response, including the bodies.")
+	maxIdleConns := flag.Int("max-idle-conns", 2,
+		"The number of idle connections to the target kept open for reuse. At least -concurrency are kept.")
+	idleConnTimeout := flag.Duration("idle-conn-timeout", 90*time.Second,
+		"How long an idle connection to the target is kept open for reuse.")
+	disableKeepAlives := flag.Bool("disable-keep-alives", false,
+		"Open a new connection to the target for every request, instead of reusing connections.")
+	proxyFlag := flag.String("proxy", "",
+		"The URL of a proxy to send every request through, like http://proxy.example.com:3128. "+
+			"Overrides the HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables.")
+	caCert := flag.String("ca-cert", "",
+		"A PEM file of the certificate authorities to trust for the target's certificate, instead of the system's.")
+	insecure := flag.Bool("insecure", false,
+		"Don't verify the target's TLS certificate. Only use this for throwaway environments.")
+	assumeYes := flag.Bool("yes", false, "Import without asking for confirmation first. For unattended runs.")
+	flag.BoolVar(assumeYes, "y", false, "Shorthand for -yes.")
+	extraFields := hours2drupal.ExtraFieldFlags{}
+	flag.Var(extraFields, "extra-field",
+		"An additional paragraph field to post, as <machine_name>=<column>, like field_cafe_hours=Cafe Hours. "+
+			"Can be repeated. Adds to the extra fields in the field map.")
+	strict := flag.Bool("strict", false,
+		"Fail on problems with the input which are otherwise warnings, like a CSV file without any data rows.")
+	deleteMonth := flag.String("delete-month", "",
+		"Delete the node with this title, like \"January, 2025\", and its paragraphs, then exit.")
+	lastWins := flag.Bool("last-wins", false,
+		"When a day appears more than once in the input, keep the last one instead of failing.")
+	export := flag.String("export", "",
+		"Write the hours already on the target to this CSV file, in the import format, then exit. Use - for stdout.")
+	composeHoursFlag := flag.String("compose-hours", "",
+		"Compose the building hours from the open and close columns using this template, like \"{open} - {close}\".")
+	skipUnchanged := flag.Bool("skip-unchanged", false,
+		"With -update, keep the existing paragraphs of days whose hours and note haven't changed.")
+	keepGoing := flag.Bool("keep-going", false,
+		"Record a month which fails and go on to the next month, then list the failed months and exit non-zero.")
+	rateLimit := flag.Float64("rate-limit", 0,
+		"The maximum number of requests to send to the target each second. Zero doesn't limit requests.")
+	configFile := flag.String("config", "",
+		"A TOML file which sets the other flags, like target = \"library.example.com\". Flags on the command line override it.")
+	resultJSON := flag.String("result-json", "",
+		"Write what the import created, each month's node and paragraph IDs and any errors, to this JSON file.")
+	monthDelay := flag.Duration("month-delay", 0, "The amount of time to pause between processing each month.")
+	runDiagnose := flag.Bool("diagnose", false, "Run a series of checks against the target then exit.")
+	printVersion := flag.Bool("version", false, "Print the version then exit.")
+	printHelp := flag.Bool("help", false, "Print help documentation then exit.")
 
-		err = json.Unmarshal(rb, p)
-		if err != nil {
-			return err
-		}
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "%v\n", hours2drupal.ProjectName)
+		fmt.Fprintf(flag.CommandLine.Output(), "Process CSV files of hours, "+
+			"and import them into a target Drupal 9 website. %v\n", Version)
+		fmt.Fprintf(flag.CommandLine.Output(), "Version %v\n", Version)
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [FLAGS] file [file...]\n", Version)
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "A file of %v reads the CSV from standard input.\n", hours2drupal.StdinArg)
+		fmt.Fprintf(flag.CommandLine.Output(), "The password is read from the %v environment variable if it is set, "+
+			"otherwise it is prompted for.\n", hours2drupal.PasswordEnvVar)
+	}
 
-		err = resp.Body.Close()
+	// Process the flags and arguments.
+	flag.Parse()
+
+	// Fill in the flags which weren't given on the command line from the config file.
+	if *configFile != "" {
+		err := ApplyConfigFile(flag.CommandLine, *configFile)
 		if err != nil {
 			return err
 		}
+	}
+
+	// Quick exit for help and version flags.
+	if *printVersion {
+		fmt.Printf("%v - Version %v.\n", hours2drupal.ProjectName, Version)
+		return nil
+	}
 
+	if *printHelp {
+		flag.CommandLine.SetOutput(os.Stdout)
+		flag.Usage()
 		return nil
 	}
 
-	// Some error occurred, return more details to the caller.
-	body, err := io.ReadAll(resp.Body)
+	// Check that the slice of arguments (csv files to import) is not empty.
+	if len(flag.Args()) == 0 && !*runDiagnose && *deleteMonth == "" && *export == "" && *reimportManifest == "" && *weekTemplate == "" {
+		return errors.New("no CSV files were given, provide at least one as an argument")
+	}
+
+	// Standard input can only be read once.
+	stdinArgs := 0
+
+	for _, arg := range flag.Args() {
+		if arg == hours2drupal.StdinArg {
+			stdinArgs++
+		}
+	}
 
+	if stdinArgs > 1 {
+		return fmt.Errorf("the %v argument, which reads from standard input, can only be given once", hours2drupal.StdinArg)
+	}
+
+	// The CSV on standard input can't share it with the confirmation prompt, which
+	// is only shown when the import writes to the target.
+	writes := !*dryRunFlag && *planOut == ""
+
+	if stdinArgs == 1 && !*assumeYes && writes {
+		return fmt.Errorf("the %v argument, which reads from standard input, requires -yes, "+
+			"since the confirmation prompt reads from standard input too", hours2drupal.StdinArg)
+	}
+
+	tlsVersion, err := hours2drupal.ParseTLSVersion(*minTLSVersion)
 	if err != nil {
 		return err
 	}
 
-	err = resp.Body.Close()
+	// Load the field map, then apply any flags which override it.
+	fm := hours2drupal.DefaultFieldMap()
+
+	if *fieldMapFile != "" {
+		fm, err = hours2drupal.LoadFieldMap(*fieldMapFile)
+		if err != nil {
+			return fmt.Errorf("loading field map failed, %w", err)
+		}
+	}
+
+	// Flags are visited in lexical order, so -node-field-name and -parent-field-name override -field-name.
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "field-name":
+			fm.NodeField = *fieldName
+			fm.ParentField = *fieldName
+		case "node-field-name":
+			fm.NodeField = *nodeFieldName
+		case "parent-field-name":
+			fm.ParentField = *parentFieldName
+		case "hours-path":
+			fm.NodePath = *hoursPath
+		case "hours-by-day-path":
+			fm.ParagraphPath = *hoursByDayPath
+		case "col-day":
+			fm.Columns.Day = *colDay
+		case "col-note":
+			fm.Columns.Note = *colNote
+		case "col-building":
+			fm.Columns.BuildingHours = *colBuilding
+		case "col-chat":
+			fm.Columns.ChatHours = *colChat
+		case "title-format":
+			fm.TitleFormat = *titleFormat
+		}
+	})
+
+	// Extra fields from the flags are added to the field map's, replacing any with the same machine name.
+	if len(extraFields) > 0 && fm.ExtraFields == nil {
+		fm.ExtraFields = map[string]string{}
+	}
+
+	for field, column := range extraFields {
+		fm.ExtraFields[field] = column
+	}
+
+	for name, path := range map[string]string{"hours-path": *hoursPath, "hours-by-day-path": *hoursByDayPath} {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("the -%v '%v' must start with a /", name, path)
+		}
+	}
+
+	grouping, err := hours2drupal.ParseGrouping(*groupBy)
 	if err != nil {
 		return err
 	}
 
-	return fmt.Errorf("%w: %v %v failed [%v]\n%v", ErrAPIError, r.Method, r.URL.String(), resp.StatusCode, string(body))
-}
-
-// HoursNode is the struct compliment of the required JSON for an hours node.
-type HoursNode struct {
-	Data struct {
-		Type       string `json:"type"`
-		ID         string `json:"id,omitempty"`
-		Attributes struct {
-			Title string `json:"title"`
-		} `json:"attributes"`
-		Relationships struct {
-			FieldDay struct {
-				Data []ParagraphRelationship `json:"data"`
-			} `json:"field_day"`
-		} `json:"relationships,omitempty"`
-	} `json:"data"`
-}
+	// Weekly nodes are titled with the week, unless the title format was changed from the default.
+	if grouping == hours2drupal.GroupByWeek && fm.TitleFormat == hours2drupal.DefaultFieldMap().TitleFormat {
+		fm.TitleFormat = hours2drupal.DefaultWeekTitleFormat
+	}
 
-// ParagraphRelationship contains the data linking the node to the paragraph.
-type ParagraphRelationship struct {
-	Type string `json:"type"`
-	ID   string `json:"id"`
-	Meta struct {
-		TargetRevisionID int `json:"target_revision_id"`
-	} `json:"meta"`
-}
+	err = hours2drupal.ValidateTitleFormat(fm.TitleFormat, grouping)
+	if err != nil {
+		return err
+	}
 
-// NewHoursNode creates a new HoursNode struct.
-func NewHoursNode(title string) HoursNode {
-	n := HoursNode{}
-	n.Data.Type = "node--hours"
-	n.Data.Attributes.Title = strings.TrimSpace(title)
+	// When the day is stored as a separate entity, it is left out of the paragraph.
+	if *fieldDayIsRelationship {
+		fm.Fields.Day = ""
+	}
 
-	return n
-}
+	if *structuredHoursLayout != "" && (fm.Fields.BuildingOpen == "" || fm.Fields.BuildingClose == "") {
+		return errors.New("the field map must name the building_open and building_close fields when -structured-hours-layout is set")
+	}
 
-// NewParagraphRelationship creates a new ParagraphRelationship.
-func NewParagraphRelationship(pType, pID string, targetRevisionID int) ParagraphRelationship {
-	p := ParagraphRelationship{}
-	p.Type = pType
-	p.ID = pID
-	p.Meta.TargetRevisionID = targetRevisionID
+	if *strictFields && fm.NodeField != fm.ParentField {
+		return fmt.Errorf("the node field name '%v' and the parent field name '%v' must match when -strict-fields is set",
+			fm.NodeField, fm.ParentField)
+	}
 
-	return p
-}
+	var nodeIDs map[string]string
 
-// Post uses the JSON API endpoint at target to create the new node.
-func (n *HoursNode) Post(ctx context.Context, target, username, password string) error {
-	url := fmt.Sprintf("https://%v%v", target, HoursPath)
-	return n.doAPICall(ctx, url, http.MethodPost, username, password)
-}
+	if *nodeIDsFile != "" {
+		nodeIDs, err = hours2drupal.LoadNodeIDs(*nodeIDsFile)
+		if err != nil {
+			return fmt.Errorf("loading node IDs failed, %w", err)
+		}
+	}
 
-// Patch uses the JSON API endpoint at target to update the new node.
-func (n *HoursNode) Patch(ctx context.Context, target, username, password string) error {
-	url := fmt.Sprintf("https://%v%v/%v", target, HoursPath, n.Data.ID)
-	return n.doAPICall(ctx, url, http.MethodPatch, username, password)
-}
+	order, err := hours2drupal.ParseAttemptOrder(*attemptOrder)
+	if err != nil {
+		return err
+	}
 
-// doAPICall calls the API using the provided method.
-func (n *HoursNode) doAPICall(ctx context.Context, url, method, username, password string) error {
-	// Create a new context from the base context with a timeout.
-	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
-	defer cancel()
+	if order == hours2drupal.AttemptOrderParagraphsFirst && *paragraphsOnly {
+		return errors.New("the paragraphs-first attempt order can't be used with -paragraphs-only")
+	}
 
-	b, err := json.Marshal(n)
+	inputEnc, err := hours2drupal.ParseInputEncoding(*inputEncoding)
 	if err != nil {
 		return err
 	}
 
-	r, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(b))
+	delim, err := hours2drupal.ParseDelimiter(*delimiter)
 	if err != nil {
 		return err
 	}
 
-	// Set the required headers.
-	r.Header.Set("Accept", AcceptHeader)
-	r.Header.Set("Content-Type", ContentTypeHeader)
-	r.SetBasicAuth(username, password)
+	commentChar, err := hours2drupal.ParseComment(*comment, delim)
+	if err != nil {
+		return err
+	}
 
-	// Do the POST request.
-	resp, err := http.DefaultClient.Do(r)
+	allowedUpdateFields, err := hours2drupal.ParseUpdateFields(*updateFields, fm)
 	if err != nil {
 		return err
 	}
 
-	// If the response is 200 or 201, update the node.
-	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
-		rb, err := io.ReadAll(resp.Body)
+	loc := time.Local
+
+	if *timezone != "" {
+		loc, err = time.LoadLocation(*timezone)
+		if err != nil {
+			return fmt.Errorf("loading time zone failed, %w", err)
+		}
+	}
+
+	if (*weekTemplate == "") != (*dateRange == "") {
+		return errors.New("the -week-template and -range flags must be used together")
+	}
+
+	var template hours2drupal.WeekTemplate
+
+	var rangeStart, rangeEnd time.Time
 
+	if *weekTemplate != "" {
+		template, err = hours2drupal.LoadWeekTemplate(*weekTemplate, hours2drupal.Config{
+			FieldMap:      fm,
+			InputEncoding: inputEnc,
+			Delimiter:     delim,
+			Comment:       commentChar,
+		})
+		if err != nil {
+			return fmt.Errorf("loading week template failed, %w", err)
+		}
+
+		rangeStart, rangeEnd, err = hours2drupal.ParseDateRange(*dateRange, loc)
 		if err != nil {
 			return err
 		}
+	}
+
+	// A target given as a URL is reduced to its host, so it isn't joined to a second scheme.
+	schemeSet := false
 
-		err = json.Unmarshal(rb, n)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "scheme" {
+			schemeSet = true
+		}
+	})
+
+	if len(targets) == 0 {
+		targets = TargetFlags{DefaultTarget}
+	}
+
+	specs := []targetSpec{}
+
+	for _, t := range targets {
+		spec := targetSpec{Username: *username}
+
+		// A server can be given its own username, like hours@law.example.com.
+		if user, host, ok := strings.Cut(t, "@"); ok && !strings.Contains(t, "://") {
+			spec.Username, t = user, host
+		}
+
+		spec.Host, spec.Scheme, err = hours2drupal.NormalizeTarget(t, *scheme, schemeSet)
 		if err != nil {
 			return err
 		}
 
-		err = resp.Body.Close()
+		specs = append(specs, spec)
+	}
+
+	// Only imports can be sent to more than one target.
+	if len(specs) > 1 {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"diagnose", *runDiagnose},
+			{"export", *export != ""},
+			{"delete-month", *deleteMonth != ""},
+			{"manifest-out", *manifestOut != ""},
+			{"reimport-manifest", *reimportManifest != ""},
+			{"plan-out", *planOut != ""},
+		} {
+			if f.set {
+				return fmt.Errorf("the -%v flag can only be used with one target", f.name)
+			}
+		}
+	}
+
+	where := targetList(specs)
+
+	if *scheme != "http" && *scheme != "https" {
+		return fmt.Errorf("the scheme '%v' is not supported, expected http or https", *scheme)
+	}
+
+	if *update && (*skipExisting || *paragraphsOnly) {
+		return errors.New("the -update flag can't be used with -skip-existing or -paragraphs-only")
+	}
+
+	if *dateLayout == "" {
+		return errors.New("the date format can't be empty")
+	}
+
+	if *composeHoursFlag != "" &&
+		(!strings.Contains(*composeHoursFlag, "{open}") || !strings.Contains(*composeHoursFlag, "{close}")) {
+		return fmt.Errorf("the -compose-hours template '%v' must contain {open} and {close}", *composeHoursFlag)
+	}
+
+	if *skipUnchanged && !*update {
+		return errors.New("the -skip-unchanged flag can only be used with -update")
+	}
+
+	if *updateFields != "" && !*update {
+		return errors.New("the -update-fields flag can only be used with -update")
+	}
+
+	if *rateLimit < 0 {
+		return errors.New("the rate limit can't be negative")
+	}
+
+	if *minMonthDays < 0 {
+		return errors.New("the minimum number of days in a month can't be negative")
+	}
+
+	if *timeout <= 0 {
+		return errors.New("the timeout must be positive")
+	}
+
+	if *concurrency < 1 {
+		return errors.New("the concurrency must be at least 1")
+	}
+
+	var proxy *url.URL
+
+	if *proxyFlag != "" {
+		proxy, err = hours2drupal.ParseProxy(*proxyFlag)
 		if err != nil {
 			return err
 		}
+	}
 
-		return nil
+	var rootCAs *x509.CertPool
+
+	if *caCert != "" {
+		rootCAs, err = hours2drupal.LoadCACert(*caCert)
+		if err != nil {
+			return fmt.Errorf("loading CA certificate failed, %w", err)
+		}
 	}
 
-	// Some error occurred, return more details to the caller.
-	body, err := io.ReadAll(resp.Body)
+	if *insecure {
+		log.Println("WARNING: -insecure is set. The target's TLS certificate will NOT be verified, " +
+			"so anyone between here and the target can read and change what is sent, including the credentials.")
+	}
 
-	if err != nil {
-		return err
+	if *maxIdleConns < 0 {
+		return errors.New("the maximum number of idle connections can't be negative")
 	}
 
-	err = resp.Body.Close()
-	if err != nil {
-		return err
+	// Keep a connection for each worker, so concurrent requests don't keep reconnecting.
+	idleConns := *maxIdleConns
+	if idleConns < *concurrency {
+		idleConns = *concurrency
 	}
 
-	return fmt.Errorf("%w: %v %v failed [%v]\n%v", ErrAPIError, r.Method, r.URL.String(), resp.StatusCode, string(body))
-}
+	if *paragraphBatchSize < 1 {
+		return errors.New("the paragraph batch size must be at least 1")
+	}
 
-// DailyHours stores the data from the CSV file, the source data for the Drupal paragraphs.
-type DailyHours struct {
-	Day           time.Time
-	Note          string
-	BuildingHours string
-	ChatHours     string
-}
+	// When the export is written to stdout, messages are written to stderr so they don't mix with it.
+	var messages io.Writer = os.Stdout
+	if *export == hours2drupal.StdinArg {
+		messages = os.Stderr
+	}
 
-func main() {
-	// Set the prefix of the default logger to the empty string.
-	log.SetFlags(0)
+	if *runDiagnose {
+		fmt.Fprintf(messages, "Going to diagnose %v.\n", where)
+	} else if *export != "" {
+		fmt.Fprintf(messages, "Going to export hours from %v.\n", where)
+	} else if *deleteMonth != "" {
+		fmt.Fprintf(messages, "Going to delete '%v' from %v.\n", *deleteMonth, where)
+	} else if *dryRunFlag {
+		fmt.Fprintf(messages, "Going to dry run an import into %v.\n", where)
+	} else if *planOut != "" {
+		fmt.Fprintf(messages, "Going to plan an import into %v in '%v'.\n", where, *planOut)
+	} else {
+		fmt.Fprintf(messages, "Going to import hours into %v.\n", where)
+	}
 
-	// Define the command line flags.
-	target := flag.String("target", "library.carleton.ca", "The name of the server to POST hours to.")
-	username := flag.String("username", "admin", "The username to use when authenticating with the target.")
-	printVersion := flag.Bool("version", false, "Print the version then exit.")
-	printHelp := flag.Bool("help", false, "Print help documentation then exit.")
+	// A bearer token replaces the password.
+	token := *bearerToken
+	if token == "" {
+		token = os.Getenv(hours2drupal.TokenEnvVar)
+	}
 
-	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "%v\n", ProjectName)
-		fmt.Fprintf(flag.CommandLine.Output(), "Process CSV files of hours, "+
-			"and import them into a target Drupal 9 website. %v\n", Version)
-		fmt.Fprintf(flag.CommandLine.Output(), "Version %v\n", Version)
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [FLAGS] file [file...]\n", Version)
-		flag.PrintDefaults()
+	// An API key also replaces the password.
+	key := *apiKey
+	if key == "" {
+		key = os.Getenv(hours2drupal.APIKeyEnvVar)
 	}
 
-	// Process the flags and arguments.
-	flag.Parse()
+	if key != "" && token != "" {
+		return errors.New("only one of a bearer token and an API key can be used")
+	}
 
-	// Quick exit for help and version flags.
-	if *printVersion {
-		fmt.Printf("%v - Version %v.\n", ProjectName, Version)
-		os.Exit(0)
+	if key != "" && strings.TrimSpace(*apiKeyHeader) == "" {
+		return errors.New("the -api-key-header can't be empty")
 	}
 
-	if *printHelp {
-		flag.CommandLine.SetOutput(os.Stdout)
-		flag.Usage()
-		os.Exit(0)
+	for _, spec := range specs {
+		switch {
+		case token != "", key != "":
+		case len(specs) > 1:
+			fmt.Fprintf(messages, "Using username '%v' for '%v'.\n", spec.Username, spec.Host)
+		default:
+			fmt.Fprintf(messages, "Using username '%v'.\n", spec.Username)
+		}
 	}
 
-	// Check that the slice of arguments (csv files to import) is not empty.
-	if len(flag.Args()) == 0 {
-		log.Fatalln("Please provide at least one CSV file as an argument.")
+	if token != "" {
+		fmt.Fprintln(messages, "Using a bearer token.")
 	}
 
-	fmt.Printf("Going to import hours into 'https://%v'.\n", *target)
-	fmt.Printf("Using username '%v'.\n", *username)
+	if key != "" {
+		fmt.Fprintf(messages, "Using an API key in the %v header.\n", *apiKeyHeader)
+	}
 
-	// Read password for username.
-	fmt.Printf("Password: ")
+	if token == "" && key == "" {
+		for i := range specs {
+			specs[i].Password, err = readPassword(specs[i], len(specs) > 1, stdinArgs == 1, messages)
+			if err != nil {
+				return err
+			}
+		}
+	}
 
-	pb, err := term.ReadPassword(int(os.Stdin.Fd()))
+	cfg := hours2drupal.Config{
+		Target:                specs[0].Host,
+		Username:              specs[0].Username,
+		Password:              specs[0].Password,
+		FieldMap:              fm,
+		MonthDelay:            *monthDelay,
+		InputAuth:             *inputAuth,
+		MaxDays:               *maxDays,
+		MinMonthDays:          *minMonthDays,
+		ParagraphBatchSize:    *paragraphBatchSize,
+		MinTLSVersion:         tlsVersion,
+		SanitizeNotes:         *sanitizeNotes,
+		AllowedNoteTags:       hours2drupal.ParseAllowedTags(*allowedNoteTags),
+		ExpectContinue:        *expectContinue,
+		StrictRelationships:   *strictRelationships,
+		Sample:                *sample,
+		TruncateTitle:         *truncateTitle,
+		CanonicalOut:          *canonicalOut,
+		DateLayout:            *dateLayout,
+		Location:              loc,
+		DetectDateLayout:      *detectDateLayout,
+		DateLayouts:           strings.Split(*dateLayouts, ";"),
+		ParagraphsOnly:        *paragraphsOnly,
+		NodeIDs:               nodeIDs,
+		Trace:                 *trace,
+		UseETag:               *useETag,
+		IgnoreUnnamedColumns:  *ignoreUnnamedColumns,
+		UpdateFields:          allowedUpdateFields,
+		InputEncoding:         inputEnc,
+		Delimiter:             delim,
+		Comment:               commentChar,
+		AttemptOrder:          order,
+		GroupBy:               grouping,
+		PlanOut:               *planOut,
+		MethodOverride:        *methodOverride,
+		Sparse:                *sparse,
+		ManifestOut:           *manifestOut,
+		ReimportManifest:      *reimportManifest,
+		Breaker:               hours2drupal.NewCircuitBreaker(*breakerThreshold, *breakerCooldown),
+		Limiter:               hours2drupal.NewRateLimiter(*rateLimit),
+		StructuredHoursLayout: *structuredHoursLayout,
+		WeekTemplate:          template,
+		RangeStart:            rangeStart,
+		RangeEnd:              rangeEnd,
+		DryRun:                *dryRunFlag,
+		Scheme:                specs[0].Scheme,
+		Concurrency:           *concurrency,
+		MaxRetries:            *maxRetries,
+		BearerToken:           token,
+		APIKey:                key,
+		APIKeyHeader:          strings.TrimSpace(*apiKeyHeader),
+		Timeout:               *timeout,
+		SkipExisting:          *skipExisting,
+		Update:                *update,
+		StrictHours:           *strictHours,
+		Verbose:               *verbose,
+		AssumeYes:             *assumeYes,
+		Strict:                *strict,
+		LastWins:              *lastWins,
+		ComposeHours:          *composeHoursFlag,
+		SkipUnchanged:         *skipUnchanged,
+		KeepGoing:             *keepGoing,
+		Rollback:              hours2drupal.NewRollback(*rollbackOnError),
+		Progress:              hours2drupal.NewProgress(messages),
+		Confirm:               confirm,
+		Client: hours2drupal.NewHTTPClient(hours2drupal.ClientOptions{
+			MinTLSVersion:       tlsVersion,
+			MaxIdleConnsPerHost: idleConns,
+			IdleConnTimeout:     *idleConnTimeout,
+			DisableKeepAlives:   *disableKeepAlives,
+			Proxy:               proxy,
+			RootCAs:             rootCAs,
+			InsecureSkipVerify:  *insecure,
+		}),
+	}
+
+	// Hide secrets from everything written from here on.
+	if *redact {
+		credentials := map[string]string{}
+		secrets := []string{cfg.BearerToken, cfg.APIKey}
+
+		for _, spec := range specs {
+			// Targets can share a username but not a password, so the other passwords are hidden as secrets.
+			if p, ok := credentials[spec.Username]; ok && p != spec.Password {
+				secrets = append(secrets, spec.Password, base64.StdEncoding.EncodeToString([]byte(spec.Username+":"+spec.Password)))
+				continue
+			}
+
+			credentials[spec.Username] = spec.Password
+		}
+
+		if parts := strings.SplitN(cfg.InputAuth, ":", 2); len(parts) == 2 {
+			credentials[parts[0]] = parts[1]
+		}
 
-	fmt.Println()
+		headers := hours2drupal.DefaultRedactedHeaders + "," + *redactHeaders
+		if cfg.APIKey != "" {
+			headers += "," + cfg.APIKeyHeader
+		}
+
+		cfg.Redactor = hours2drupal.NewRedactor(headers, credentials, secrets...)
+		cfg.Progress = hours2drupal.NewProgress(cfg.Redactor.Writer(messages))
 
+		log.SetOutput(cfg.Redactor.Writer(os.Stderr))
+	}
+
+	// Structured logs replace the progress messages, and the log package's output is sent through them too.
+	cfg.Logger, err = hours2drupal.NewLogger(*logFormat, cfg.Redactor.Writer(os.Stderr))
 	if err != nil {
-		log.Fatalf("Error reading password: %v.\n", err)
+		return err
 	}
 
-	password := string(pb)
+	// The status line is redrawn in place, so it is only shown on a terminal.
+	if messages == os.Stdout && term.IsTerminal(int(os.Stdout.Fd())) {
+		cfg.Progress.EnableStatus()
+	}
 
-	err = process(flag.Args(), *target, *username, password)
-	if err != nil {
-		log.Fatalf("Error: %v.\n", err)
+	if cfg.Logger != nil {
+		cfg.Progress = hours2drupal.NewProgress(io.Discard)
+
+		slog.SetDefault(cfg.Logger)
+	}
+
+	if *runDiagnose {
+		if !hours2drupal.Diagnose(context.Background(), cfg) {
+			return errDiagnosisFailed
+		}
+
+		return nil
 	}
-}
 
-// process creates a context and processes the arguments.
-func process(args []string, target, username, password string) error {
-	hours := []DailyHours{}
+	if *export != "" {
+		hours, err := hours2drupal.ExportHours(context.Background(), cfg)
+		if err != nil {
+			return fmt.Errorf("exporting hours failed, %w", err)
+		}
 
-	// Load input from CSV files.
-	for _, arg := range args {
-		h, err := loadFromCSV(arg)
+		err = hours2drupal.WriteExport(*export, hours)
 		if err != nil {
-			return fmt.Errorf("processing CSV file '%v' failed, %w", arg, err)
+			return fmt.Errorf("writing export '%v' failed, %w", *export, err)
 		}
 
-		hours = append(hours, h...)
+		fmt.Fprintf(messages, "Exported %v days.\n", len(hours))
+		return nil
 	}
 
-	// Partition the days by month.
-	months := map[string][]DailyHours{}
+	if *deleteMonth != "" {
+		nodes, paragraphs, err := hours2drupal.DeleteMonth(context.Background(), cfg, *deleteMonth)
+		cfg.Progress.Printf("Deleted %v nodes and %v paragraphs.\n", nodes, paragraphs)
+
+		if err != nil {
+			return fmt.Errorf("deleting '%v' failed, %w", *deleteMonth, err)
+		}
 
-	for _, h := range hours {
-		monthAndYear := h.Day.Format("January, 2006")
-		months[monthAndYear] = append(months[monthAndYear], h)
+		return nil
 	}
 
-	// Create a context which can be cancelled by a SIGINT signal.
+	// Each target gets its own rollback, so only what was created in it is undone there.
+	cfgs := []hours2drupal.Config{}
+
+	for _, spec := range specs {
+		c := cfg
+		c.Target, c.Scheme, c.Username, c.Password = spec.Host, spec.Scheme, spec.Username, spec.Password
+		c.Rollback = hours2drupal.NewRollback(*rollbackOnError)
+
+		cfgs = append(cfgs, c)
+	}
+
+	// The Pushgateway has its own client, with the system's certificate authorities
+	// and the default TLS settings, since -ca-cert, -insecure, and -min-tls-version only apply to the target.
+	metricsClient := hours2drupal.NewHTTPClient(hours2drupal.ClientOptions{Proxy: proxy})
+
+	// Interrupting the import cancels the context, which stops it before its next request.
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
-	// For every month, we create the 'container' node, then the containing paragraphs
-	// which are then patched in.
-	for month, dailyHours := range months {
-		fmt.Printf("%v...", month)
-		n := NewHoursNode(month)
+	// The input is loaded once, then imported into each target.
+	hours, nodeIDs, err := hours2drupal.LoadHours(ctx, flag.Args(), cfg)
+	if err != nil || len(cfgs) == 1 {
+		result := hours2drupal.Result{}
+		if err == nil {
+			result, err = hours2drupal.ImportHours(ctx, hours, nodeIDs, cfgs[0])
+		}
 
-		err := n.Post(ctx, target, username, password)
-		if err != nil {
-			return err
+		writeResultJSON(*resultJSON, []hours2drupal.TargetResult{{Target: cfgs[0].BaseURL(), Result: result, Err: err}}, cfg.Redactor)
+
+		return finishImport(cfgs[0], result, err, *metricsPushgateway, metricsClient)
+	}
+
+	// One target failing doesn't stop the import into the others.
+	failed := map[string]error{}
+	results := []hours2drupal.TargetResult{}
+
+	for _, c := range cfgs {
+		if ctx.Err() != nil {
+			failed[c.BaseURL()] = ctx.Err()
+			continue
 		}
 
-		for _, h := range dailyHours {
-			// Has our context been cancelled?
-			if ctx.Err() != nil {
-				return ctx.Err()
-			}
+		fmt.Fprintf(messages, "Importing into '%v'.\n", c.BaseURL())
 
-			p := NewHoursByDayParagraph(n.Data.ID, h.BuildingHours, h.ChatHours, h.Day.Format("2006-01-02"), h.Note)
+		result, err := hours2drupal.ImportHours(ctx, hours, nodeIDs, c)
+		results = append(results, hours2drupal.TargetResult{Target: c.BaseURL(), Result: result, Err: err})
 
-			err := p.Post(ctx, target, username, password)
-			if err != nil {
-				return err
+		err = finishImport(c, result, err, *metricsPushgateway, metricsClient)
+		if err != nil {
+			failed[c.BaseURL()] = err
+
+			reported := reportedError{}
+			if !errors.As(err, &reported) {
+				log.Printf("Error: %v.\n", err)
 			}
+		}
+	}
 
-			r := NewParagraphRelationship(p.Data.Type, p.Data.ID, p.Data.Attributes.DrupalInternalRevisionID)
-			n.Data.Relationships.FieldDay.Data = append(n.Data.Relationships.FieldDay.Data, r)
+	writeResultJSON(*resultJSON, results, cfg.Redactor)
 
-			err = n.Patch(ctx, target, username, password)
-			if err != nil {
-				return err
-			}
+	for _, c := range cfgs {
+		if err, ok := failed[c.BaseURL()]; ok {
+			fmt.Fprintf(cfg.Progress, "  '%v': failed, %v.\n", c.BaseURL(), err)
+		} else {
+			fmt.Fprintf(cfg.Progress, "  '%v': imported.\n", c.BaseURL())
 		}
+	}
 
-		fmt.Println(" Success")
+	if len(failed) > 0 {
+		return fmt.Errorf("%w: %v of %v targets", errTargetsFailed, len(failed), len(cfgs))
 	}
 
 	return nil
 }
 
-// loadFromCSV processes one of the provided hours CSV files.
-func loadFromCSV(arg string) (hours []DailyHours, err error) {
-	f, err := os.Open(arg)
+// writeResultJSON writes the results of the imports to path, if it is set.
+// The imports are already finished, so an error writing the file is only logged, like an error pushing metrics.
+func writeResultJSON(path string, results []hours2drupal.TargetResult, r *hours2drupal.Redactor) {
+	if path == "" {
+		return
+	}
+
+	err := hours2drupal.WriteResultJSON(path, results, r)
 	if err != nil {
-		return hours, err
+		log.Printf("Error writing result JSON '%v': %v.\n", path, err)
 	}
+}
 
-	r := csv.NewReader(f)
+// finishImport reports the result of an import into the target: it pushes the metrics, summarizes what was created,
+// and offers to roll back a failed import or to delete the samples. A failed import's error is returned as a
+// reportedError, since it has already been reported.
+func finishImport(cfg hours2drupal.Config, result hours2drupal.Result, err error,
+	metricsURL string, metricsClient *http.Client) error {
+	if metricsURL != "" {
+		m := hours2drupal.RunMetrics{
+			Target:       cfg.Target,
+			Result:       "success",
+			DaysImported: result.Days(),
+			Duration:     result.Duration,
+		}
 
-	// A map of column names to indexes.
-	h := map[string]int{}
+		if err != nil {
+			m.Result = "failure"
+			m.Errors = 1
+		}
+
+		if len(result.Failed) > 0 {
+			m.Errors = len(result.Failed)
+		}
 
-	// If the first line doesn't exist, return the header error.
-	l, err := r.Read()
-	if errors.Is(err, io.EOF) {
-		return hours, ErrNoHeader
+		pushErr := m.Push(context.Background(), metricsClient, cfg.Timeout, metricsURL)
+		if pushErr != nil {
+			log.Printf("Error pushing metrics: %v.\n", pushErr)
+		}
 	}
 
 	if err != nil {
-		return hours, err
-	}
+		// With -keep-going, the months which were imported are summarized, then the ones which failed are listed.
+		if len(result.Failed) > 0 {
+			result.WriteSummary(cfg.Progress)
+			result.WriteFailures(os.Stderr)
+		}
+
+		log.Printf("Error: %v.\n", err)
+		cfg.LogEvent(slog.LevelError, "import failed", "error", err.Error(), "nodes", len(result.Nodes),
+			"paragraphs", result.Days(), "duration", result.Duration.String())
+
+		// Offer to undo the partial import.
+		nodes, paragraphs := cfg.Rollback.Counts()
+		if nodes+paragraphs > 0 {
+			q := fmt.Sprintf("The import created %v nodes and %v paragraphs before it stopped. Delete them?", nodes, paragraphs)
+			if confirm(q) {
+				err := cfg.Rollback.Undo(context.Background(), cfg)
+				if err != nil {
+					return fmt.Errorf("rolling back failed, %w", err)
+				}
+
+				fmt.Println("Rolled back.")
+			}
+		}
 
-	// Build the column name map from the header line.
-	for i, header := range l {
-		h[strings.TrimSpace(header)] = i
+		return reportedError{err}
 	}
 
-	// Keep track of the line number for error reporting.
-	lineNum := 1
+	// A plan doesn't create anything, so there is nothing to summarize.
+	if cfg.PlanOut == "" {
+		result.WriteSummary(cfg.Progress)
+		cfg.LogEvent(slog.LevelInfo, "import finished", "nodes", len(result.Nodes), "paragraphs", result.Days(),
+			"duration", result.Duration.String())
+	}
 
-	for {
-		lineNum++
+	// Offer to remove the samples once they have been checked on the target.
+	if cfg.Sample {
+		fmt.Printf("Created %v sample nodes. Check them on '%v'.\n", len(result.Nodes), cfg.BaseURL())
 
-		l, err := r.Read()
+		if confirm("Delete the samples?") {
+			err := hours2drupal.DeleteCreated(context.Background(), cfg, result)
+			if err != nil {
+				return fmt.Errorf("deleting samples failed, %w", err)
+			}
 
-		if errors.Is(err, io.EOF) {
-			break
+			fmt.Println("Samples deleted.")
 		}
+	}
 
-		if err != nil {
-			return hours, err
-		}
+	return nil
+}
 
-		// Pull the data from the line using the header map, trimming leading and trailing space.
-		note := strings.TrimSpace(l[h["note"]])
-		buildingHours := strings.TrimSpace(l[h["building hours"]])
-		chatHours := strings.TrimSpace(l[h["chat hours"]])
+// confirm asks the user a yes or no question on the terminal, returning true only if they answer yes.
+func confirm(question string) bool {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false
+	}
 
-		day := strings.TrimSpace(l[h["day"]])
-		if day == "" {
-			return hours, fmt.Errorf("%w: empty day on line %v", ErrMissingData, lineNum)
-		}
+	fmt.Printf("%v [y/N] ", question)
 
-		// Parse the day into a Time so we can more easily process it later.
-		// The reference time is documented here: https://golang.org/pkg/time/#Parse
-		parsedDay, err := time.Parse("2006-01-02", day)
-		if err != nil {
-			return hours, fmt.Errorf("Could not parse day on line %v: %w", lineNum, err)
-		}
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
 
-		if buildingHours == "" {
-			return hours, fmt.Errorf("%w: empty building hours on line %v", ErrMissingData, lineNum)
-		}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
+
+// TargetFlags collects the repeatable -target flag.
+type TargetFlags []string
 
-		if chatHours == "" {
-			return hours, fmt.Errorf("%w: empty chat hours on line %v", ErrMissingData, lineNum)
+// String returns the targets, separated by commas.
+func (t *TargetFlags) String() string {
+	return strings.Join(*t, ",")
+}
+
+// Set adds a target.
+func (t *TargetFlags) Set(value string) error {
+	*t = append(*t, value)
+
+	return nil
+}
+
+// targetSpec is a target the hours are imported into, with the credentials used there.
+type targetSpec struct {
+	Host     string
+	Scheme   string
+	Username string
+	Password string
+}
+
+// targetList returns the URLs of the targets, quoted and separated by commas, for messages.
+func targetList(specs []targetSpec) string {
+	urls := []string{}
+
+	for _, spec := range specs {
+		urls = append(urls, fmt.Sprintf("'%v://%v'", spec.Scheme, spec.Host))
+	}
+
+	return strings.Join(urls, ", ")
+}
+
+// targetPasswordEnvVar returns the environment variable a target's own password is read from,
+// like HOURS2DRUPAL_PASSWORD_LAW_EXAMPLE_COM for law.example.com.
+func targetPasswordEnvVar(host string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
 		}
 
-		n := DailyHours{
-			Day:           parsedDay,
-			Note:          note,
-			BuildingHours: buildingHours,
-			ChatHours:     chatHours,
+		return '_'
+	}, host)
+
+	return hours2drupal.PasswordEnvVar + "_" + strings.ToUpper(name)
+}
+
+// readPassword returns the password for the target from the target's own environment variable,
+// the PasswordEnvVar environment variable, or a prompt on the terminal, in that order.
+// The prompt names the target if there is more than one. It isn't shown when the CSV is read from standard input.
+func readPassword(spec targetSpec, named, stdin bool, messages io.Writer) (string, error) {
+	// The password can be provided in the environment, for unattended runs.
+	for _, name := range []string{targetPasswordEnvVar(spec.Host), hours2drupal.PasswordEnvVar} {
+		if password, ok := os.LookupEnv(name); ok {
+			if password == "" {
+				return "", fmt.Errorf("no credentials were provided. Enter a password, or set -bearer-token, -api-key, or the %v environment variable",
+					hours2drupal.TokenEnvVar)
+			}
+
+			return password, nil
 		}
+	}
+
+	// The prompt would read the password from the CSV, or the CSV from the password.
+	if stdin {
+		return "", fmt.Errorf("reading password failed, the CSV is read from standard input. "+
+			"Set the %v environment variable, or use -bearer-token or -api-key", hours2drupal.PasswordEnvVar)
+	}
+
+	// Reading the password requires a terminal, so fail with an actionable message if there isn't one.
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("reading password failed, %w. "+
+			"Set the %v environment variable, authenticate with -bearer-token or the %v environment variable, "+
+			"or -api-key or the %v environment variable, or run %v from a terminal to be prompted for the password",
+			hours2drupal.ErrNoTerminal, hours2drupal.PasswordEnvVar, hours2drupal.TokenEnvVar, hours2drupal.APIKeyEnvVar,
+			hours2drupal.ProjectName)
+	}
+
+	// Read password for username.
+	if named {
+		fmt.Fprintf(messages, "Password for '%v' on '%v': ", spec.Username, spec.Host)
+	} else {
+		fmt.Fprintf(messages, "Password: ")
+	}
+
+	pb, err := term.ReadPassword(int(os.Stdin.Fd()))
+
+	fmt.Fprintln(messages)
+
+	if err != nil {
+		return "", fmt.Errorf("reading password failed, %w", err)
+	}
 
-		hours = append(hours, n)
+	if len(pb) == 0 {
+		return "", fmt.Errorf("no credentials were provided. Enter a password, or set -bearer-token, -api-key, or the %v environment variable",
+			hours2drupal.TokenEnvVar)
 	}
 
-	return hours, nil
+	return string(pb), nil
 }
@@ -0,0 +1,142 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrBatchUnsupported is an error which is returned when the target doesn't accept bulk paragraph creation.
+var ErrBatchUnsupported = errors.New("the target does not support creating paragraphs in batches")
+
+// ErrBatchMismatch is an error which is returned when the target accepts a batch of paragraphs
+// but its response doesn't match the paragraphs which were sent.
+var ErrBatchMismatch = errors.New("the target's response did not match the batch of paragraphs")
+
+// batchPointer matches the index of the item in a JSON:API error's source pointer, like "/data/3/attributes".
+var batchPointer = regexp.MustCompile(`^/data/(\d+)`) //nolint:gochecknoglobals
+
+// batchDocument is the request and response of a bulk paragraph creation request.
+// The data is an array of resource objects the server is expected to answer with an array of its own.
+type batchDocument struct {
+	Data json.RawMessage `json:"data"`
+}
+
+// batchErrors are the JSON:API errors in the response to a rejected bulk paragraph creation request.
+type batchErrors struct {
+	Errors []struct {
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+		Source struct {
+			Pointer string `json:"pointer"`
+		} `json:"source"`
+	} `json:"errors"`
+}
+
+// PostParagraphs uses the JSON API endpoint at target to create all of the paragraphs with one request.
+// The payload is a JSON:API document with an array of resource objects, which not all servers support.
+// If the target rejects the array as a whole, ErrBatchUnsupported is returned and the
+// caller should fall back to creating the paragraphs one at a time. If the target accepts the request
+// but doesn't return every paragraph, ErrBatchMismatch is returned, since some of them may have been created.
+func PostParagraphs(ctx context.Context, ps []HoursByDayParagraph, cfg Config) error {
+	items := []interface{}{}
+	for _, p := range ps {
+		items = append(items, p.Data)
+	}
+
+	data, err := marshalBody(items)
+	if err != nil {
+		return err
+	}
+
+	url := sparseParagraphURL(fmt.Sprintf("%v%v", cfg.BaseURL(), cfg.FieldMap.ParagraphPath), cfg)
+	doc := batchDocument{Data: data}
+
+	_, err = callAPI(ctx, cfg, url, http.MethodPost, &doc, nil)
+	if err != nil {
+		return batchError(err, ps)
+	}
+
+	// Update each paragraph from the matching item in the response.
+	returned := []json.RawMessage{}
+
+	err = json.Unmarshal(doc.Data, &returned)
+	if err != nil {
+		return fmt.Errorf("%w: %v %v, the response's data is not an array", ErrBatchMismatch, http.MethodPost, url)
+	}
+
+	if len(returned) != len(ps) {
+		return fmt.Errorf("%w: %v %v, sent %v paragraphs but %v were returned",
+			ErrBatchMismatch, http.MethodPost, url, len(ps), len(returned))
+	}
+
+	for i := range ps {
+		err = json.Unmarshal(returned[i], &ps[i].Data)
+		if err != nil {
+			return err
+		}
+
+		if ps[i].Data.ID == "" {
+			return fmt.Errorf("%w: %v %v, item %v", ErrMissingID, http.MethodPost, url, i)
+		}
+
+		cfg.Rollback.AddParagraph(ps[i].Data.ID)
+	}
+
+	return nil
+}
+
+// batchError explains why the target rejected a bulk paragraph creation request.
+// Errors which point at items in the batch are reported with the day of the paragraph.
+// A request rejected as a whole returns ErrBatchUnsupported, since the server most likely
+// doesn't understand array payloads.
+func batchError(err error, ps []HoursByDayParagraph) error {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	be := batchErrors{}
+	// A body which isn't JSON is handled below using the status code alone.
+	_ = json.Unmarshal([]byte(apiErr.Body), &be)
+
+	failures := []string{}
+
+	for _, e := range be.Errors {
+		m := batchPointer.FindStringSubmatch(e.Source.Pointer)
+		if m == nil {
+			continue
+		}
+
+		i, err := strconv.Atoi(m[1])
+		if err != nil || i >= len(ps) {
+			continue
+		}
+
+		failures = append(failures, fmt.Sprintf("item %v (day %v): %v %v",
+			i, ps[i].Data.Attributes.Day, e.Title, e.Detail))
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%w: %v %v failed [%v]\n%v",
+			ErrAPIError, apiErr.Method, apiErr.URL, apiErr.StatusCode, strings.Join(failures, "\n"))
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusBadRequest, http.StatusMethodNotAllowed, http.StatusUnsupportedMediaType,
+		http.StatusUnprocessableEntity:
+		return fmt.Errorf("%w [%v]", ErrBatchUnsupported, apiErr.StatusCode)
+	}
+
+	return err
+}
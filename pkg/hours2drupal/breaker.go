@@ -0,0 +1,115 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is an error which is returned when the target keeps failing and the circuit breaker aborts the import.
+var ErrCircuitOpen = errors.New("the target returned too many server errors in a row")
+
+// CircuitBreaker stops sending requests to a target which returns consecutive server errors.
+// Once tripped, requests wait for the cooldown before being sent, or fail if there is no cooldown.
+// A nil CircuitBreaker never trips.
+type CircuitBreaker struct {
+	mu          sync.Mutex
+	threshold   int
+	cooldown    time.Duration
+	consecutive int
+	tripped     bool
+	// resume is when requests are sent again after the breaker tripped.
+	resume time.Time
+}
+
+// NewCircuitBreaker creates a CircuitBreaker which trips after threshold consecutive server errors.
+// A threshold of zero returns nil, which disables the circuit breaker.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Wait is called before sending a request. If the breaker has tripped, it waits for the cooldown
+// and then resets the breaker, or returns ErrCircuitOpen if there is no cooldown.
+// Concurrent requests wait for the same cooldown, and the lock isn't held while waiting.
+func (b *CircuitBreaker) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+
+	if !b.tripped {
+		b.mu.Unlock()
+		return nil
+	}
+
+	if b.cooldown == 0 {
+		consecutive := b.consecutive
+		b.mu.Unlock()
+
+		return fmt.Errorf("%w, aborting after %v", ErrCircuitOpen, consecutive)
+	}
+
+	wait := time.Until(b.resume)
+
+	b.mu.Unlock()
+
+	err := sleep(ctx, wait)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// The first request to finish waiting resets the breaker for the others.
+	if b.tripped && !time.Now().Before(b.resume) {
+		b.tripped = false
+		b.consecutive = 0
+
+		log.Println("Circuit breaker: reset, resuming requests.")
+	}
+
+	return nil
+}
+
+// Record is called with the status code of every response, and trips the breaker
+// after the threshold of consecutive server errors.
+func (b *CircuitBreaker) Record(statusCode int) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if statusCode < http.StatusInternalServerError {
+		b.consecutive = 0
+		return
+	}
+
+	b.consecutive++
+
+	if b.consecutive >= b.threshold && !b.tripped {
+		b.tripped = true
+		b.resume = time.Now().Add(b.cooldown)
+		log.Printf("Circuit breaker: tripped after %v consecutive server errors.\n", b.consecutive)
+
+		if b.cooldown > 0 {
+			log.Printf("Circuit breaker: pausing requests for %v.\n", b.cooldown)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// WriteCanonicalCSV writes the hours to a CSV file at path, in the form they are sent to Drupal.
+// The file always uses the default column headers, whatever headers the input used, and the
+// days are sorted so that the output of the same input is identical between runs.
+// Extra fields are written in columns named with the fields' machine names.
+func WriteCanonicalCSV(path string, hours []DailyHours) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	return writeCanonicalCSV(f, hours)
+}
+
+// writeCanonicalCSV writes the hours to out as CSV, using the default column headers and sorted by day.
+func writeCanonicalCSV(out io.Writer, hours []DailyHours) error {
+	// Collect the extra fields used by any day, so every row has the same columns.
+	extraSet := map[string]bool{}
+
+	for _, h := range hours {
+		for field := range h.Extra {
+			extraSet[field] = true
+		}
+	}
+
+	extras := []string{}
+	for field := range extraSet {
+		extras = append(extras, field)
+	}
+
+	sort.Strings(extras)
+
+	sorted := append([]DailyHours{}, hours...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Day.Before(sorted[j].Day)
+	})
+
+	c := DefaultFieldMap().Columns
+	w := csv.NewWriter(out)
+
+	header := []string{c.Day, c.Note, c.BuildingHours, c.ChatHours, c.NodeTitle, c.Reference, c.Holiday}
+	header = append(header, extras...)
+
+	err := w.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range sorted {
+		row := []string{h.Day.Format("2006-01-02"), h.Note, h.BuildingHours, h.ChatHours, h.NodeTitle, h.Reference,
+			strconv.FormatBool(h.Holiday)}
+
+		for _, field := range extras {
+			row = append(row, h.Extra[field])
+		}
+
+		err = w.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+
+	return w.Error()
+}
@@ -0,0 +1,458 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ClientOptions configure the transport of the HTTP client.
+type ClientOptions struct {
+	// MinTLSVersion is the minimum TLS version accepted from the target.
+	MinTLSVersion uint16
+	// MaxIdleConnsPerHost is the number of idle connections kept open to the target for reuse.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept open. Zero keeps the default.
+	IdleConnTimeout time.Duration
+	// DisableKeepAlives opens a new connection for every request.
+	DisableKeepAlives bool
+	// RootCAs are the certificate authorities trusted to sign the target's certificate.
+	// If nil, the system's certificate authorities are trusted.
+	RootCAs *x509.CertPool
+	// InsecureSkipVerify accepts any certificate from the target. It is only for throwaway environments.
+	InsecureSkipVerify bool
+	// Proxy is the proxy every request is sent through. If nil, the proxy is read from the
+	// HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables.
+	Proxy *url.URL
+}
+
+// NewHTTPClient creates the HTTP client shared by every request to the target.
+// Its transport pools connections, so a large import doesn't open a connection for every request.
+func NewHTTPClient(opts ClientOptions) *http.Client {
+	t, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return &http.Client{}
+	}
+
+	t = t.Clone()
+	t.TLSClientConfig = &tls.Config{ //nolint:gosec
+		MinVersion:         opts.MinTLSVersion,
+		RootCAs:            opts.RootCAs,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+	t.DisableKeepAlives = opts.DisableKeepAlives
+
+	// The cloned transport already uses http.ProxyFromEnvironment.
+	if opts.Proxy != nil {
+		t.Proxy = http.ProxyURL(opts.Proxy)
+	}
+
+	if opts.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	}
+
+	if opts.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = opts.IdleConnTimeout
+	}
+
+	return &http.Client{Transport: t}
+}
+
+// LoadCACert reads the PEM encoded certificates in the file at path into a pool of trusted certificate authorities.
+func LoadCACert(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("%w: '%v' has no PEM encoded certificates", ErrInvalidCACert, path)
+	}
+
+	return pool, nil
+}
+
+// tlsConfig returns a copy of the TLS configuration the HTTP client uses to reach the target.
+func (cfg Config) tlsConfig() *tls.Config {
+	if t, ok := cfg.HTTPClient().Transport.(*http.Transport); ok && t.TLSClientConfig != nil {
+		return t.TLSClientConfig.Clone()
+	}
+
+	return &tls.Config{MinVersion: cfg.MinTLSVersion} //nolint:gosec
+}
+
+// ParseProxy parses a proxy URL like http://proxy.example.com:3128.
+func ParseProxy(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: '%v', %v", ErrInvalidProxy, s, err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") || u.Host == "" {
+		return nil, fmt.Errorf("%w: '%v', expected a URL like http://proxy.example.com:3128", ErrInvalidProxy, s)
+	}
+
+	return u, nil
+}
+
+// ParseTLSVersion converts a TLS version like "1.2" into its crypto/tls constant.
+func ParseTLSVersion(v string) (uint16, error) {
+	switch v {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+
+	return 0, fmt.Errorf("%w: '%v', expected one of 1.0, 1.1, 1.2, or 1.3", ErrInvalidTLSVersion, v)
+}
+
+// setAuth authenticates the request with the API key, if one is configured, then the bearer token,
+// if one is configured, and otherwise with basic auth using the username and password.
+func setAuth(r *http.Request, cfg Config) {
+	if cfg.APIKey != "" {
+		r.Header.Set(cfg.apiKeyHeader(), cfg.APIKey)
+		return
+	}
+
+	if cfg.BearerToken != "" {
+		r.Header.Set("Authorization", "Bearer "+cfg.BearerToken)
+		return
+	}
+
+	r.SetBasicAuth(cfg.Username, cfg.Password)
+}
+
+// apiKeyHeader returns the header the API key is sent in, or DefaultAPIKeyHeader if none was configured.
+func (cfg Config) apiKeyHeader() string {
+	if cfg.APIKeyHeader == "" {
+		return DefaultAPIKeyHeader
+	}
+
+	return cfg.APIKeyHeader
+}
+
+// setExpectContinue asks the server to confirm it will accept the request before the body is sent, if configured.
+// The transport waits up to its ExpectContinueTimeout for the 100 Continue response.
+func setExpectContinue(r *http.Request, cfg Config) {
+	if cfg.ExpectContinue {
+		r.Header.Set("Expect", "100-continue")
+	}
+}
+
+// BaseURL returns the scheme and name of the target, like "https://library.carleton.ca".
+// The scheme defaults to https.
+func (cfg Config) BaseURL() string {
+	scheme := cfg.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	return scheme + "://" + cfg.Target
+}
+
+// NormalizeTarget checks the target is a host name, with an optional port, and returns it with the scheme to use.
+// A full URL like https://library.carleton.ca/ is accepted, and its scheme is used unless schemeSet is true,
+// in which case it must match scheme. Schemes other than http and https are an error.
+func NormalizeTarget(target, scheme string, schemeSet bool) (string, string, error) {
+	host := target
+
+	if i := strings.Index(host, "://"); i >= 0 {
+		urlScheme := strings.ToLower(host[:i])
+		if schemeSet && urlScheme != scheme {
+			return "", "", fmt.Errorf("%w: '%v' uses %v, but -scheme is %v", ErrInvalidTarget, target, urlScheme, scheme)
+		}
+
+		scheme = urlScheme
+		host = host[i+len("://"):]
+	}
+
+	if scheme != "http" && scheme != "https" {
+		return "", "", fmt.Errorf("%w: '%v' uses %v, expected http or https", ErrInvalidTarget, target, scheme)
+	}
+
+	host = strings.TrimRight(host, "/")
+
+	if host == "" || strings.ContainsAny(host, "/?#@ ") {
+		return "", "", fmt.Errorf("%w: '%v', expected a host name like library.carleton.ca", ErrInvalidTarget, target)
+	}
+
+	return host, scheme, nil
+}
+
+// requestTimeout returns the configured timeout for requests, or RequestTimeout if none was configured.
+func (cfg Config) requestTimeout() time.Duration {
+	if cfg.Timeout <= 0 {
+		return RequestTimeout
+	}
+
+	return cfg.Timeout
+}
+
+// HTTPClient returns the configured HTTP client, or the default client if none was configured.
+func (cfg Config) HTTPClient() *http.Client {
+	if cfg.Client == nil {
+		return http.DefaultClient
+	}
+
+	return cfg.Client
+}
+
+// APIError is returned when the Drupal API responds with an unexpected status code.
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+	// RetryAfter is the value of the response's Retry-After header, if it had one.
+	RetryAfter string
+}
+
+// Error describes the failed request and includes the reason the server gave for the failure.
+// JSON:API errors in the response body are summarized, otherwise the body is included as it is.
+func (e *APIError) Error() string {
+	if details := e.Details(); details != "" {
+		return fmt.Sprintf("%v: %v %v failed [%v]: %v", ErrAPIError, e.Method, e.URL, e.StatusCode, details)
+	}
+
+	return fmt.Sprintf("%v: %v %v failed [%v]\n%v", ErrAPIError, e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+// Details summarizes the JSON:API errors in the response body, like "field_day: value is required".
+// Each error is described by its detail, or its title if it has no detail, prefixed by the field
+// its source pointer names. It returns an empty string if the body doesn't contain JSON:API errors.
+func (e *APIError) Details() string {
+	doc := struct {
+		Errors []struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+			Source struct {
+				Pointer string `json:"pointer"`
+			} `json:"source"`
+		} `json:"errors"`
+	}{}
+
+	if json.Unmarshal([]byte(e.Body), &doc) != nil {
+		return ""
+	}
+
+	messages := []string{}
+
+	for _, d := range doc.Errors {
+		message := strings.TrimSpace(d.Detail)
+		if message == "" {
+			message = strings.TrimSpace(d.Title)
+		}
+
+		message = strings.TrimSuffix(message, ".")
+
+		if message == "" {
+			continue
+		}
+
+		// Drupal often names the field in the detail already, as in "field_day: This value should not be null."
+		pointer := strings.TrimSuffix(d.Source.Pointer, "/")
+		if field := pointer[strings.LastIndex(pointer, "/")+1:]; field != "" && field != "data" &&
+			!strings.HasPrefix(message, field+":") {
+			message = field + ": " + message
+		}
+
+		messages = append(messages, message)
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap allows errors.Is to match APIErrors against ErrAPIError.
+func (e *APIError) Unwrap() error {
+	return ErrAPIError
+}
+
+// hasStatus reports whether err is an APIError with the status code.
+func hasStatus(err error, code int) bool {
+	var apiErr *APIError
+
+	return errors.As(err, &apiErr) && apiErr.StatusCode == code
+}
+
+// callAPI calls the API using the provided method, sending v as the body
+// and unmarshalling a successful response back into it.
+// GET and DELETE requests, or requests where v is nil, have no body.
+// Any headers in h are added to the request, and the response's headers are returned.
+// Requests which fail with a transient error are retried, up to cfg.MaxRetries times.
+func callAPI(ctx context.Context, cfg Config, url, method string, v interface{}, h http.Header) (http.Header, error) {
+	var body []byte
+
+	if v != nil && method != http.MethodGet && method != http.MethodDelete {
+		b, err := marshalBody(v)
+		if err != nil {
+			return nil, err
+		}
+
+		body = b
+
+		// Only print what would be sent.
+		if cfg.DryRun {
+			return http.Header{}, dryRun(cfg, url, method, b, v)
+		}
+	}
+
+	// Reads are still made during a dry run, but nothing is deleted.
+	if cfg.DryRun && method == http.MethodDelete {
+		return http.Header{}, dryRun(cfg, url, method, nil, nil)
+	}
+
+	for attempt := 0; ; attempt++ {
+		rh, err := sendRequest(ctx, cfg, url, method, body, v, h)
+
+		delay, retry := retryDelay(ctx, method, err, attempt, cfg.MaxRetries)
+		if !retry {
+			return rh, err
+		}
+
+		log.Printf("Retrying %v %v in %v: %v.\n", method, url, delay.Round(time.Millisecond), retryReason(err))
+
+		err = sleep(ctx, delay)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sendRequest makes one attempt at a request for callAPI.
+// A nil body sends a request without one.
+func sendRequest(ctx context.Context, cfg Config, url, method string, body []byte,
+	v interface{}, h http.Header) (http.Header, error) {
+	// Don't send the request while the target is failing. The waits aren't limited by the request's timeout,
+	// since a cooldown can be longer than it.
+	err := cfg.Breaker.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't send requests faster than the target allows.
+	if cfg.Limiter != nil {
+		err = cfg.Limiter.Wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Create a new context from the base context with a timeout.
+	ctx, cancel := context.WithTimeout(ctx, cfg.requestTimeout())
+	defer cancel()
+
+	var reqBody io.Reader = http.NoBody
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	ctx, traced := withTrace(ctx, cfg, method, url)
+	defer traced()
+
+	// Intermediaries which block PATCH and DELETE let them through as a POST with an override header.
+	wireMethod := method
+	if cfg.MethodOverride && (method == http.MethodPatch || method == http.MethodDelete) {
+		wireMethod = http.MethodPost
+	}
+
+	r, err := http.NewRequestWithContext(ctx, wireMethod, url, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if wireMethod != method {
+		r.Header.Set(MethodOverrideHeader, method)
+	}
+
+	// Set the required headers.
+	r.Header.Set("Accept", AcceptHeader)
+	r.Header.Set("Content-Type", ContentTypeHeader)
+	setAuth(r, cfg)
+	setExpectContinue(r, cfg)
+
+	for key, values := range h {
+		for _, value := range values {
+			r.Header.Add(key, value)
+		}
+	}
+
+	logRequest(cfg, r, body)
+
+	// Do the request.
+	resp, err := cfg.HTTPClient().Do(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Breaker.Record(resp.StatusCode)
+
+	// If the response is 204, there is nothing to update.
+	if resp.StatusCode == http.StatusNoContent {
+		logResponse(cfg, r, resp, nil)
+
+		return resp.Header, resp.Body.Close()
+	}
+
+	// If the response is 200 or 201, update v.
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+		rb, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		logResponse(cfg, r, resp, rb)
+
+		err = json.Unmarshal(rb, v)
+		if err != nil {
+			return nil, err
+		}
+
+		err = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		return resp.Header, nil
+	}
+
+	// Some error occurred, return more details to the caller.
+	rb, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	logResponse(cfg, r, resp, rb)
+
+	err = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, &APIError{
+		Method: r.Method, URL: r.URL.String(), StatusCode: resp.StatusCode, Body: string(rb),
+		RetryAfter: resp.Header.Get("Retry-After"),
+	}
+}
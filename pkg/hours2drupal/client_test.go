@@ -0,0 +1,46 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeTarget(t *testing.T) {
+	tests := []struct {
+		target     string
+		scheme     string
+		schemeSet  bool
+		wantHost   string
+		wantScheme string
+		wantErr    error
+	}{
+		{target: "library.carleton.ca", scheme: "https", wantHost: "library.carleton.ca", wantScheme: "https"},
+		{target: "localhost:8080", scheme: "http", schemeSet: true, wantHost: "localhost:8080", wantScheme: "http"},
+		{target: "https://library.carleton.ca/", scheme: "https", wantHost: "library.carleton.ca", wantScheme: "https"},
+		{target: "HTTP://localhost:8080", scheme: "https", wantHost: "localhost:8080", wantScheme: "http"},
+		{target: "http://library.carleton.ca", scheme: "https", schemeSet: true, wantErr: ErrInvalidTarget},
+		{target: "ftp://library.carleton.ca", scheme: "https", wantErr: ErrInvalidTarget},
+		{target: "gopher://library.carleton.ca", scheme: "https", wantErr: ErrInvalidTarget},
+		{target: "library.carleton.ca", scheme: "ftp", wantErr: ErrInvalidTarget},
+		{target: "https://library.carleton.ca/hours", scheme: "https", wantErr: ErrInvalidTarget},
+		{target: "https://", scheme: "https", wantErr: ErrInvalidTarget},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			host, scheme, err := NormalizeTarget(tt.target, tt.scheme, tt.schemeSet)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NormalizeTarget() = %v, want %v", err, tt.wantErr)
+			}
+
+			if host != tt.wantHost || scheme != tt.wantScheme {
+				t.Errorf("NormalizeTarget() = %v, %v, want %v, %v", host, scheme, tt.wantHost, tt.wantScheme)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"context"
+	"fmt"
+)
+
+// DeleteMonth deletes the nodes titled title, and the hours by day paragraphs they reference.
+// Paragraphs of other types were added on the target, not by the tool, so they are left alone.
+// Unless AssumeYes is set, the operator is asked to confirm first.
+// It returns the number of nodes and paragraphs which were deleted, even if an error occurs partway through.
+func DeleteMonth(ctx context.Context, cfg Config, title string) (nodes, paragraphs int, err error) {
+	found, err := FindHoursNodes(ctx, cfg, title)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(found) == 0 {
+		return 0, 0, fmt.Errorf("%w: no node is titled '%v'", ErrNodeNotFound, title)
+	}
+
+	total := 0
+	for _, n := range found {
+		for _, r := range n.Data.Relationships.Data {
+			if r.Type == cfg.FieldMap.ParagraphType {
+				total++
+			}
+		}
+	}
+
+	if !cfg.AssumeYes {
+		q := fmt.Sprintf("Delete %v node(s) titled '%v' and their %v paragraphs from %v?", len(found), title, total, cfg.BaseURL())
+		if !cfg.confirm(q) {
+			return 0, 0, fmt.Errorf("%w, answer yes at the prompt or set -yes", ErrNotConfirmed)
+		}
+	}
+
+	for _, n := range found {
+		// The paragraphs are deleted first, so a failure doesn't leave them without a node.
+		for _, r := range n.Data.Relationships.Data {
+			// Only paragraphs of the hours by day type were created by the tool.
+			if r.Type != cfg.FieldMap.ParagraphType {
+				continue
+			}
+
+			p := HoursByDayParagraph{}
+			p.Data.Type = r.Type
+			p.Data.ID = r.ID
+
+			err := p.Delete(ctx, cfg)
+			if err != nil {
+				return nodes, paragraphs, err
+			}
+
+			paragraphs++
+		}
+
+		err := n.Delete(ctx, cfg)
+		if err != nil {
+			return nodes, paragraphs, err
+		}
+
+		nodes++
+	}
+
+	return nodes, paragraphs, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestDeleteMonthOnlyDeletesHoursParagraphs(t *testing.T) {
+	const title = "Hours - January 2025"
+
+	fm := DefaultFieldMap()
+
+	n := NewHoursNode(title, fm)
+	n.Data.ID = "node-1"
+	n.Data.Relationships.Data = []ParagraphRelationship{
+		{Type: fm.ParagraphType, ID: "hours-1"},
+		{Type: "paragraph--banner", ID: "banner-1"},
+		{Type: fm.ParagraphType, ID: "hours-2"},
+	}
+
+	collection, err := json.Marshal(struct {
+		Data []interface{} `json:"data"`
+	}{[]interface{}{n.Data}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+
+	deleted := []string{}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			mu.Lock()
+			deleted = append(deleted, r.URL.Path)
+			mu.Unlock()
+
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", ContentTypeHeader)
+		_, _ = w.Write(collection)
+	}))
+	defer s.Close()
+
+	cfg := testServerConfig(s)
+	cfg.AssumeYes = true
+
+	nodes, paragraphs, err := DeleteMonth(context.Background(), cfg, title)
+	if err != nil {
+		t.Fatalf("DeleteMonth() failed, %v", err)
+	}
+
+	if nodes != 1 || paragraphs != 2 {
+		t.Errorf("DeleteMonth() = %v nodes and %v paragraphs, want 1 and 2", nodes, paragraphs)
+	}
+
+	want := []string{fm.ParagraphPath + "/hours-1", fm.ParagraphPath + "/hours-2", fm.NodePath + "/node-1"}
+	if !reflect.DeepEqual(deleted, want) {
+		t.Errorf("DeleteMonth() deleted %v, want %v", deleted, want)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ErrDiagnosticFailed is an error which is returned when a diagnostic check does not pass.
+var ErrDiagnosticFailed = errors.New("check failed")
+
+// diagnosticCheck is one of the checks run by Diagnose.
+type diagnosticCheck struct {
+	Name string
+	Run  func(ctx context.Context, cfg Config) error
+}
+
+// Diagnose runs a battery of checks against the target, printing a pass or fail line for each.
+// It returns true if every check passed.
+func Diagnose(ctx context.Context, cfg Config) bool {
+	checks := []diagnosticCheck{
+		{"DNS resolution", checkDNS},
+		{"JSON:API root reachable", checkJSONAPIRoot},
+		{"Authentication valid", checkAuth},
+		{"Hours node type exists", func(ctx context.Context, cfg Config) error {
+			return checkResourceType(ctx, cfg, cfg.FieldMap.NodePath)
+		}},
+		{"Hours by day paragraph type exists", func(ctx context.Context, cfg Config) error {
+			return checkResourceType(ctx, cfg, cfg.FieldMap.ParagraphPath)
+		}},
+	}
+
+	// There is no handshake to check over plain http.
+	if cfg.Scheme != "http" {
+		checks = append([]diagnosticCheck{checks[0], {"TLS handshake", checkTLS}}, checks[1:]...)
+	}
+
+	passed := true
+
+	for _, c := range checks {
+		start := time.Now()
+		err := c.Run(ctx, cfg)
+		elapsed := time.Since(start).Round(time.Millisecond)
+
+		if err != nil {
+			passed = false
+
+			fmt.Printf("FAIL  %v (%v): %v\n", c.Name, elapsed, err)
+
+			continue
+		}
+
+		fmt.Printf("PASS  %v (%v)\n", c.Name, elapsed)
+	}
+
+	return passed
+}
+
+// checkDNS checks that the target's name resolves.
+func checkDNS(ctx context.Context, cfg Config) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.requestTimeout())
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, hostname(cfg.Target))
+	if err != nil {
+		return err
+	}
+
+	if len(addrs) == 0 {
+		return fmt.Errorf("%w: no addresses found", ErrDiagnosticFailed)
+	}
+
+	return nil
+}
+
+// checkTLS checks that a TLS connection can be established with the target.
+func checkTLS(ctx context.Context, cfg Config) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.requestTimeout())
+	defer cancel()
+
+	addr := cfg.Target
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "443")
+	}
+
+	d := tls.Dialer{Config: cfg.tlsConfig()}
+
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// checkJSONAPIRoot checks that the JSON:API root responds without credentials.
+func checkJSONAPIRoot(ctx context.Context, cfg Config) error {
+	status, _, err := diagnosticGet(ctx, cfg, "/jsonapi", false)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return fmt.Errorf("%w: GET /jsonapi returned [%v]", ErrDiagnosticFailed, status)
+	}
+
+	return nil
+}
+
+// checkAuth checks that the credentials are accepted.
+// Drupal includes a link to the current user in the JSON:API root's meta when the request is authenticated.
+func checkAuth(ctx context.Context, cfg Config) error {
+	status, body, err := diagnosticGet(ctx, cfg, "/jsonapi", true)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return fmt.Errorf("%w: GET /jsonapi returned [%v]", ErrDiagnosticFailed, status)
+	}
+
+	root := struct {
+		Meta struct {
+			Links struct {
+				Me *struct{} `json:"me"`
+			} `json:"links"`
+		} `json:"meta"`
+	}{}
+
+	err = json.Unmarshal(body, &root)
+	if err != nil {
+		return err
+	}
+
+	if root.Meta.Links.Me == nil {
+		return fmt.Errorf("%w: the credentials for '%v' were not accepted", ErrDiagnosticFailed, cfg.Username)
+	}
+
+	return nil
+}
+
+// checkResourceType checks that the JSON:API collection at path exists.
+func checkResourceType(ctx context.Context, cfg Config, path string) error {
+	status, _, err := diagnosticGet(ctx, cfg, path+"?page[limit]=1", true)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return fmt.Errorf("%w: GET %v returned [%v]", ErrDiagnosticFailed, path, status)
+	}
+
+	return nil
+}
+
+// diagnosticGet does a GET request against the path on the target, returning the status code and body.
+func diagnosticGet(ctx context.Context, cfg Config, path string, authenticate bool) (int, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.requestTimeout())
+	defer cancel()
+
+	url := fmt.Sprintf("%v%v", cfg.BaseURL(), path)
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	r.Header.Set("Accept", AcceptHeader)
+
+	if authenticate {
+		setAuth(r, cfg)
+	}
+
+	resp, err := cfg.HTTPClient().Do(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+// hostname returns the target without any port.
+func hostname(target string) string {
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return target
+	}
+
+	return host
+}
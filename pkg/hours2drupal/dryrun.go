@@ -0,0 +1,56 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// dryRunIDs counts the placeholder IDs given to entities which a dry run would have created.
+var dryRunIDs uint64 //nolint:gochecknoglobals
+
+// dryRun prints the request which would have been sent instead of sending it.
+// Entities which would have been created are given a placeholder ID, so the rest of the
+// import can be built from them as usual.
+func dryRun(cfg Config, url, method string, body []byte, v interface{}) error {
+	pretty := bytes.Buffer{}
+	if len(body) > 0 {
+		err := json.Indent(&pretty, body, "", "  ")
+		if err != nil {
+			return err
+		}
+	}
+
+	cfg.progress().Printf("\n%v %v\n%v\n", method, url, pretty.String())
+
+	if method != http.MethodPost || v == nil {
+		return nil
+	}
+
+	doc := map[string]map[string]interface{}{}
+
+	err := json.Unmarshal(body, &doc)
+	if err != nil {
+		return err
+	}
+
+	if doc["data"] == nil {
+		return nil
+	}
+
+	doc["data"]["id"] = fmt.Sprintf("dry-run-%v", atomic.AddUint64(&dryRunIDs, 1))
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// ErrInvalidEncoding is an error which is returned when an input isn't valid in the expected encoding.
+var ErrInvalidEncoding = errors.New("invalid encoding")
+
+// ErrUnknownEncoding is an error which is returned when the input encoding isn't supported.
+var ErrUnknownEncoding = errors.New("unknown input encoding")
+
+// utf8BOM is the byte order mark spreadsheet programs like Excel write at the start of UTF-8 files.
+const utf8BOM = "\xef\xbb\xbf"
+
+// InputEncodings are the encodings the CSV inputs can be transcoded from, keyed by name.
+// UTF-8 has no entry, since inputs in UTF-8 are only validated.
+//
+//nolint:gochecknoglobals
+var InputEncodings = map[string]encoding.Encoding{
+	"windows-1252": charmap.Windows1252,
+	"iso-8859-1":   charmap.ISO8859_1,
+	"latin1":       charmap.ISO8859_1,
+	"iso-8859-15":  charmap.ISO8859_15,
+}
+
+// ParseInputEncoding returns the encoding with the given name.
+// A nil encoding is returned for UTF-8.
+func ParseInputEncoding(name string) (encoding.Encoding, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "utf-8" || name == "utf8" {
+		return nil, nil
+	}
+
+	enc, ok := InputEncodings[name]
+	if !ok {
+		return nil, fmt.Errorf("%w '%v'", ErrUnknownEncoding, name)
+	}
+
+	return enc, nil
+}
+
+// decodeInput returns a reader of the input converted to UTF-8.
+// With a nil encoding, the input must already be valid UTF-8. Whatever the encoding, a leading
+// byte order mark is removed once the input is in UTF-8, so it doesn't become part of the first column's header.
+func decodeInput(r io.Reader, enc encoding.Encoding) (io.Reader, error) {
+	if enc != nil {
+		r = enc.NewDecoder().Reader(r)
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if enc == nil && !utf8.Valid(b) {
+		return nil, fmt.Errorf("%w: line %v is not valid UTF-8, try setting -input-encoding",
+			ErrInvalidEncoding, invalidUTF8Line(b))
+	}
+
+	return bytes.NewReader(bytes.TrimPrefix(b, []byte(utf8BOM))), nil
+}
+
+// invalidUTF8Line returns the number of the first line which isn't valid UTF-8.
+func invalidUTF8Line(b []byte) int {
+	for i, line := range bytes.Split(b, []byte("\n")) {
+		if !utf8.Valid(line) {
+			return i + 1
+		}
+	}
+
+	return 0
+}
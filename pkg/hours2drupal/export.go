@@ -0,0 +1,164 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// exportPage is one page of hours nodes, with their paragraphs included.
+type exportPage struct {
+	Data     []json.RawMessage `json:"data"`
+	Included []struct {
+		ID         string                     `json:"id"`
+		Attributes map[string]json.RawMessage `json:"attributes"`
+	} `json:"included"`
+	Links struct {
+		Next struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"links"`
+}
+
+// ExportHours reads every hours node and its paragraphs from the target, following the pages of the collection.
+// Days are given a node title only if their node's title isn't the one the import would give their month,
+// so the hours can be written in the import format and imported again.
+func ExportHours(ctx context.Context, cfg Config) ([]DailyHours, error) {
+	fm := cfg.FieldMap
+
+	q := url.Values{}
+	q.Set("include", fm.NodeField)
+
+	next := fmt.Sprintf("%v%v?%v", cfg.BaseURL(), fm.NodePath, q.Encode())
+	hours := []DailyHours{}
+
+	for next != "" {
+		page := exportPage{}
+
+		_, err := callAPI(ctx, cfg, next, http.MethodGet, &page, nil)
+		if err != nil {
+			return hours, err
+		}
+
+		paragraphs := map[string]map[string]json.RawMessage{}
+		for _, p := range page.Included {
+			paragraphs[p.ID] = p.Attributes
+		}
+
+		for _, raw := range page.Data {
+			n := NewHoursNode("", fm)
+
+			err := json.Unmarshal(raw, &n.Data)
+			if err != nil {
+				return hours, err
+			}
+
+			for _, r := range n.Data.Relationships.Data {
+				attributes, ok := paragraphs[r.ID]
+				if !ok {
+					return hours, fmt.Errorf("%w: paragraph %v of '%v' wasn't included in the response",
+						ErrMissingData, r.ID, n.Data.Attributes.Title)
+				}
+
+				h, err := exportedDay(attributes, n.Data.Attributes.Title, cfg)
+				if err != nil {
+					return hours, fmt.Errorf("exporting paragraph %v of '%v' failed, %w", r.ID, n.Data.Attributes.Title, err)
+				}
+
+				hours = append(hours, h)
+			}
+		}
+
+		next = page.Links.Next.Href
+	}
+
+	return hours, nil
+}
+
+// exportedDay converts a paragraph's attributes into the day they were imported from.
+func exportedDay(attributes map[string]json.RawMessage, title string, cfg Config) (DailyHours, error) {
+	fm := cfg.FieldMap
+	h := DailyHours{Extra: map[string]string{}}
+
+	day := attributeText(attributes, fm.Fields.Day)
+	if len(day) < len("2006-01-02") {
+		return h, fmt.Errorf("%w: the paragraph has no day", ErrMissingData)
+	}
+
+	// Date and time fields are returned with a time, so only the date is parsed.
+	d, err := parseDay("2006-01-02", day[:len("2006-01-02")], cfg.location())
+	if err != nil {
+		return h, fmt.Errorf("%w: day '%v': %v", ErrInvalidData, day, err)
+	}
+
+	h.Day = d
+	h.Note = attributeText(attributes, fm.Fields.Note)
+	h.BuildingHours = attributeText(attributes, fm.Fields.BuildingHours)
+	h.ChatHours = attributeText(attributes, fm.Fields.ChatHours)
+	h.Holiday = attributeBool(attributes, fm.Fields.Holiday)
+
+	for field := range fm.ExtraFields {
+		h.Extra[field] = attributeText(attributes, field)
+	}
+
+	if title != groupTitle(d, fm.TitleFormat, cfg.GroupBy) {
+		h.NodeTitle = title
+	}
+
+	return h, nil
+}
+
+// attributeText returns the text of the attribute with the machine name.
+// Formatted text fields are returned as an object, so their value is used.
+// A missing or empty attribute is returned as an empty string.
+func attributeText(attributes map[string]json.RawMessage, name string) string {
+	raw, ok := attributes[name]
+	if name == "" || !ok {
+		return ""
+	}
+
+	s := ""
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+
+	formatted := struct {
+		Value string `json:"value"`
+	}{}
+	if json.Unmarshal(raw, &formatted) == nil {
+		return formatted.Value
+	}
+
+	return ""
+}
+
+// attributeBool returns the value of the boolean attribute with the machine name.
+// A missing or null attribute is returned as false.
+func attributeBool(attributes map[string]json.RawMessage, name string) bool {
+	raw, ok := attributes[name]
+	if name == "" || !ok {
+		return false
+	}
+
+	b := false
+	_ = json.Unmarshal(raw, &b)
+
+	return b
+}
+
+// WriteExport writes the exported hours as CSV to the file at path, or to stdout if path is StdinArg.
+func WriteExport(path string, hours []DailyHours) error {
+	if path == StdinArg {
+		return writeCanonicalCSV(os.Stdout, hours)
+	}
+
+	return WriteCanonicalCSV(path, hours)
+}
@@ -0,0 +1,285 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidFieldMap is an error which is returned when a field map file is incomplete or malformed.
+var ErrInvalidFieldMap = errors.New("invalid field map")
+
+// ErrInvalidUpdateField is an error which is returned when an update field isn't a paragraph field in the field map.
+var ErrInvalidUpdateField = errors.New("invalid update field")
+
+// ErrInvalidExtraField is an error which is returned when an -extra-field flag isn't in the form <machine_name>=<column>.
+var ErrInvalidExtraField = errors.New("invalid extra field")
+
+// FieldMap describes the Drupal content model the hours are imported into,
+// and how the columns of the CSV files map onto it.
+type FieldMap struct {
+	// NodeType is the JSON:API type of the container node, like "node--hours".
+	NodeType string `json:"node_type"`
+	// NodePath is the path to append to the target to build the full URL for container nodes.
+	NodePath string `json:"node_path"`
+	// ParagraphType is the JSON:API type of the daily paragraphs, like "paragraph--hours_by_day".
+	ParagraphType string `json:"paragraph_type"`
+	// ParagraphPath is the path to append to the target to build the full URL for daily paragraphs.
+	ParagraphPath string `json:"paragraph_path"`
+	// NodeField is the machine name of the node's field which references the paragraphs.
+	NodeField string `json:"node_field"`
+	// ParentField is the machine name of the parent field recorded on each paragraph.
+	// Drupal expects it to name the node field which references the paragraph, so it
+	// normally matches NodeField.
+	ParentField string `json:"parent_field"`
+	// TitleFormat is the Go time layout used to build each month's node title,
+	// or a template with the layout in braces, like "Hours - {January 2006}". See FormatTitle.
+	TitleFormat string `json:"title_format"`
+	// Columns are the CSV headers of the columns the tool reads.
+	Columns Columns `json:"columns"`
+	// Fields are the machine names of the paragraph fields the columns are posted in.
+	Fields ParagraphFields `json:"fields"`
+	// ReferenceField is the machine name of an optional paragraph field which references another node.
+	ReferenceField string `json:"reference_field"`
+	// ReferenceType is the JSON:API type of the node the reference field points at, like "node--page".
+	ReferenceType string `json:"reference_type"`
+	// ExtraFields maps the machine names of additional paragraph fields to the CSV headers they are read from.
+	ExtraFields map[string]string `json:"extra_fields"`
+}
+
+// Columns are the CSV headers of the columns the tool reads.
+type Columns struct {
+	Day           string `json:"day"`
+	Note          string `json:"note"`
+	BuildingHours string `json:"building_hours"`
+	ChatHours     string `json:"chat_hours"`
+	NodeTitle     string `json:"node_title"`
+	Reference     string `json:"reference"`
+	// Holiday is the optional column which marks a day as a holiday, like true or no.
+	Holiday string `json:"holiday"`
+	// Open and Close are the columns the building hours are composed from with -compose-hours.
+	Open  string `json:"open"`
+	Close string `json:"close"`
+}
+
+// ParagraphFields are the machine names of the paragraph fields the columns are posted in.
+// A field with an empty name is left out of the paragraph.
+type ParagraphFields struct {
+	Day           string `json:"day"`
+	Note          string `json:"note"`
+	BuildingHours string `json:"building_hours"`
+	ChatHours     string `json:"chat_hours"`
+	// BuildingOpen and BuildingClose are the fields the building hours are posted in as structured times.
+	BuildingOpen  string `json:"building_open"`
+	BuildingClose string `json:"building_close"`
+	// Holiday is the boolean field which marks a day as a holiday.
+	Holiday string `json:"holiday"`
+}
+
+// DefaultFieldMap returns the field map for Carleton's content model.
+func DefaultFieldMap() FieldMap {
+	return FieldMap{
+		NodeType:      "node--hours",
+		NodePath:      HoursPath,
+		ParagraphType: "paragraph--hours_by_day",
+		ParagraphPath: HoursByDayPath,
+		NodeField:     "field_day",
+		ParentField:   "field_day",
+		ReferenceType: "node--page",
+		TitleFormat:   "January, 2006",
+		Columns: Columns{
+			Day:           "day",
+			Note:          "note",
+			BuildingHours: "building hours",
+			ChatHours:     "chat hours",
+			NodeTitle:     "node title",
+			Reference:     "reference",
+			Holiday:       "holiday",
+			Open:          "open",
+			Close:         "close",
+		},
+		Fields: ParagraphFields{
+			Day:           "field_day",
+			Note:          "field_note",
+			BuildingHours: "field_building_hours",
+			ChatHours:     "field_chat_hours",
+			BuildingOpen:  "field_building_open",
+			BuildingClose: "field_building_close",
+			Holiday:       "field_holiday",
+		},
+	}
+}
+
+// LoadFieldMap reads a JSON field map from path.
+// Settings missing from the file keep their values from DefaultFieldMap.
+func LoadFieldMap(path string) (FieldMap, error) {
+	fm := DefaultFieldMap()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fm, err
+	}
+	defer f.Close()
+
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+
+	err = d.Decode(&fm)
+	if err != nil {
+		return fm, fmt.Errorf("%w: %v: %v", ErrInvalidFieldMap, path, err)
+	}
+
+	return fm, fm.Validate()
+}
+
+// Validate checks that the settings required to build requests are present.
+func (fm FieldMap) Validate() error {
+	required := map[string]string{
+		"node_type":              fm.NodeType,
+		"node_path":              fm.NodePath,
+		"paragraph_type":         fm.ParagraphType,
+		"paragraph_path":         fm.ParagraphPath,
+		"node_field":             fm.NodeField,
+		"parent_field":           fm.ParentField,
+		"title_format":           fm.TitleFormat,
+		"columns.day":            fm.Columns.Day,
+		"columns.building_hours": fm.Columns.BuildingHours,
+		"columns.chat_hours":     fm.Columns.ChatHours,
+	}
+
+	for name, value := range required {
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf("%w: %v must be set", ErrInvalidFieldMap, name)
+		}
+	}
+
+	err := ValidateTitleFormat(fm.TitleFormat, GroupByMonth)
+	if err != nil {
+		return fmt.Errorf("%w: title_format: %v", ErrInvalidFieldMap, err)
+	}
+
+	for _, path := range []string{fm.NodePath, fm.ParagraphPath} {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("%w: path '%v' must start with a /", ErrInvalidFieldMap, path)
+		}
+	}
+
+	if fm.ReferenceField != "" && (fm.ReferenceType == "" || fm.Columns.Reference == "") {
+		return fmt.Errorf("%w: reference_type and columns.reference must be set when reference_field is", ErrInvalidFieldMap)
+	}
+
+	for field, column := range fm.ExtraFields {
+		if field == "" || column == "" {
+			return fmt.Errorf("%w: extra fields must have a field name and a column", ErrInvalidFieldMap)
+		}
+	}
+
+	return nil
+}
+
+// ExtraFieldFlags collects repeated -extra-field flags, mapping the machine names of paragraph fields to CSV headers.
+type ExtraFieldFlags map[string]string
+
+// String returns the extra fields in the form the flag is given in, sorted by field name.
+func (e ExtraFieldFlags) String() string {
+	fields := []string{}
+	for field, column := range e {
+		fields = append(fields, field+"="+column)
+	}
+
+	sort.Strings(fields)
+
+	return strings.Join(fields, ",")
+}
+
+// Set adds an extra field given as <machine_name>=<column>.
+func (e ExtraFieldFlags) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+		return fmt.Errorf("%w: '%v', expected <machine_name>=<column>", ErrInvalidExtraField, s)
+	}
+
+	e[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+
+	return nil
+}
+
+// ParseUpdateFields converts a comma separated list of paragraph fields into a set.
+// The names are the keys of the field map's fields, like "note", or the machine names of its extra fields.
+// An empty list returns a nil set, which allows every field.
+func ParseUpdateFields(list string, fm FieldMap) (map[string]bool, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+
+	known := map[string]bool{
+		"day": true, "note": true, "building_hours": true, "chat_hours": true,
+		"building_open": true, "building_close": true, "holiday": true,
+	}
+	for name := range fm.ExtraFields {
+		known[name] = true
+	}
+
+	allowed := map[string]bool{}
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		if !known[name] {
+			return nil, fmt.Errorf("%w, '%v'", ErrInvalidUpdateField, name)
+		}
+
+		allowed[name] = true
+	}
+
+	return allowed, nil
+}
+
+// Restrict returns a copy of the fields with the machine names of fields not in allowed cleared,
+// so they are left out when the paragraph is marshalled. A nil set allows every field.
+func (f ParagraphFields) Restrict(allowed map[string]bool) ParagraphFields {
+	if allowed == nil {
+		return f
+	}
+
+	if !allowed["day"] {
+		f.Day = ""
+	}
+
+	if !allowed["note"] {
+		f.Note = ""
+	}
+
+	if !allowed["building_hours"] {
+		f.BuildingHours = ""
+	}
+
+	if !allowed["chat_hours"] {
+		f.ChatHours = ""
+	}
+
+	if !allowed["building_open"] {
+		f.BuildingOpen = ""
+	}
+
+	if !allowed["building_close"] {
+		f.BuildingClose = ""
+	}
+
+	if !allowed["holiday"] {
+		f.Holiday = ""
+	}
+
+	return f
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidGrouping is an error which is returned when an unknown grouping is requested.
+var ErrInvalidGrouping = errors.New("invalid grouping")
+
+// Grouping is how the days are partitioned into container nodes.
+type Grouping string
+
+const (
+	// GroupByMonth creates a node for each month, titled with the first day of the month the day falls in.
+	GroupByMonth Grouping = "month"
+	// GroupByWeek creates a node for each ISO week, titled with the Monday the week starts on.
+	// It is normally used with DefaultWeekTitleFormat, since the default title format only names the month.
+	GroupByWeek Grouping = "week"
+)
+
+// DefaultWeekTitleFormat is the title format of weekly nodes, like "Week of 2025-01-06".
+const DefaultWeekTitleFormat = "Week of {2006-01-02}"
+
+// ParseGrouping converts the name of a grouping into a Grouping.
+func ParseGrouping(name string) (Grouping, error) {
+	switch g := Grouping(name); g {
+	case GroupByMonth, GroupByWeek:
+		return g, nil
+	default:
+		return "", fmt.Errorf("%w '%v', expected month or week", ErrInvalidGrouping, name)
+	}
+}
+
+// groupTitle builds the title of the node the day is grouped into using the title format.
+// Weekly nodes are titled with the Monday of the day's ISO week, which may be in the previous month or year.
+func groupTitle(day time.Time, format string, grouping Grouping) string {
+	if grouping == GroupByWeek {
+		return FormatTitle(weekStart(day), format)
+	}
+
+	return FormatTitle(day, format)
+}
+
+// weekStart returns the Monday which starts the ISO week the day falls in.
+func weekStart(day time.Time) time.Time {
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
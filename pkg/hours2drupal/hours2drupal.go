@@ -0,0 +1,1484 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+// Package hours2drupal creates building hours in Drupal 9 from CSV files, using Drupal's JSON API.
+// The hours2drupal command is a thin wrapper around it.
+package hours2drupal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// ProjectName is the name of the executable, as displayed to the user in usage and version messages.
+	ProjectName = "hours2drupal"
+	// HoursPath is the path to append to the target to build the full URL for Hours nodes.
+	HoursPath = "/jsonapi/node/hours"
+	// HoursByDayPath is the path to append to the target to build the full URL for hours_by_day paragraphs.
+	HoursByDayPath = "/jsonapi/paragraph/hours_by_day"
+	// RequestTimeout is the default amount of time the tool will wait for API calls to complete before they are cancelled.
+	RequestTimeout = 60 * time.Second
+	// AcceptHeader is the MIME type Drupal's JSON API expects to see in the Accept header of POST requests.
+	AcceptHeader = "application/vnd.api+json"
+	// MaxTitleLength is the maximum number of characters in a Drupal node title.
+	MaxTitleLength = 255
+	// DateLayoutSampleSize is the number of days used to detect the date layout of a file.
+	DateLayoutSampleSize = 10
+	// DefaultDateLayout is the Go time layout of the days in the day column.
+	DefaultDateLayout = "2006-01-02"
+	// DefaultDateLayouts are the date layouts tried, in order, when detecting the date layout of a file.
+	// They are separated by semicolons, since some layouts contain commas.
+	DefaultDateLayouts = "2006-01-02;2006/01/02;01/02/2006;02-Jan-2006;January 2, 2006;Jan 2, 2006"
+	// MaxETagAttempts is the number of times a node PATCH is attempted when the node keeps changing underneath it.
+	MaxETagAttempts = 3
+	// SampleTitlePrefix is prepended to the title of nodes created with -dry-run-sample.
+	SampleTitlePrefix = "[Sample] "
+	// ContentTypeHeader is the MIME type Drupal's JSON API expects to see in the Content-Type header of POST requests.
+	ContentTypeHeader = "application/vnd.api+json"
+	// UsernameEnvVar is the environment variable the default username is read from, if it is set.
+	UsernameEnvVar = "HOURS2DRUPAL_USERNAME"
+	// DefaultUsername is the username used if neither -username nor UsernameEnvVar is set.
+	DefaultUsername = "admin"
+	// PasswordEnvVar is the environment variable the password is read from, if it is set.
+	PasswordEnvVar = "HOURS2DRUPAL_PASSWORD"
+	// TokenEnvVar is the environment variable the bearer token is read from, if -bearer-token isn't set.
+	TokenEnvVar = "HOURS2DRUPAL_TOKEN"
+	// APIKeyEnvVar is the environment variable the API key is read from, if -api-key isn't set.
+	APIKeyEnvVar = "HOURS2DRUPAL_API_KEY"
+	// DefaultAPIKeyHeader is the header the API key is sent in, if no other header is configured.
+	DefaultAPIKeyHeader = "X-API-Key"
+	// StdinArg is the argument which reads a CSV file from standard input.
+	StdinArg = "-"
+	// MethodOverrideHeader is the header which carries the real method of a request sent as a POST.
+	MethodOverrideHeader = "X-HTTP-Method-Override"
+)
+
+// ErrNoHeader is an error which is returned when a CSV file doesn't have a header line.
+var ErrNoHeader = errors.New("csv file did not have a header")
+
+// ErrNoData is an error which is returned when a CSV file has a header but no data lines.
+var ErrNoData = errors.New("no data")
+
+// ErrDuplicateDay is an error which is returned when a day appears more than once in the input.
+var ErrDuplicateDay = errors.New("duplicate days")
+
+// ErrInvalidHeader is an error which is returned when a CSV file's header line can't be used.
+var ErrInvalidHeader = errors.New("invalid header")
+
+// ErrMissingData is an error which is returned when a CSV file has missing fields.
+var ErrMissingData = errors.New("missing data")
+
+// ErrInvalidData is an error which is returned when a CSV file has a field which can't be used.
+var ErrInvalidData = errors.New("invalid data")
+
+// uuidPattern matches a UUID in its canonical, lower case, form.
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`) //nolint:gochecknoglobals
+
+// hoursRange matches a range of times like "9:00am - 5:00pm" or "9-5".
+const hoursRange = `\d{1,2}(:\d{2})? ?(am|pm)? ?[-–] ?\d{1,2}(:\d{2})? ?(am|pm)?`
+
+// hoursPattern matches hours like "9:00am - 5:00pm", "9am-12pm, 1pm-5pm", "Closed", or "24 Hours", ignoring case.
+var hoursPattern = regexp.MustCompile(`(?i)^(closed|(open )?24 hours|` + //nolint:gochecknoglobals
+	hoursRange + `(, ?` + hoursRange + `)*)$`)
+
+// ErrNoTerminal is an error which is returned when the password can't be read because stdin is not a terminal.
+var ErrNoTerminal = errors.New("no terminal is available")
+
+// ErrInputFetch is an error which is returned when a CSV file can't be fetched from a URL.
+var ErrInputFetch = errors.New("fetching input failed")
+
+// ErrMonthsFailed is an error which is returned when months failed to import with -keep-going.
+var ErrMonthsFailed = errors.New("some months failed to import")
+
+// ErrNotConfirmed is an error which is returned when the operator doesn't confirm the import.
+var ErrNotConfirmed = errors.New("the import was not confirmed")
+
+// ErrTooManyDays is an error which is returned when more days are loaded than the operator allowed.
+var ErrTooManyDays = errors.New("too many days")
+
+// ErrSmallMonth is an error which is returned when a month has fewer days than expected and -strict is set.
+var ErrSmallMonth = errors.New("month has too few days")
+
+// ErrInvalidTLSVersion is an error which is returned when an unknown TLS version is requested.
+var ErrInvalidTLSVersion = errors.New("invalid TLS version")
+
+// ErrInvalidDelimiter is an error which is returned when the CSV delimiter isn't a single character.
+var ErrInvalidDelimiter = errors.New("invalid delimiter")
+
+// ErrInvalidComment is an error which is returned when the CSV comment character isn't a single character.
+var ErrInvalidComment = errors.New("invalid comment character")
+
+// ErrInvalidProxy is an error which is returned when the proxy isn't an http, https, or socks5 URL.
+var ErrInvalidProxy = errors.New("invalid proxy")
+
+// ErrInvalidTarget is an error which is returned when the target isn't a host name.
+var ErrInvalidTarget = errors.New("invalid target")
+
+// ErrInvalidCACert is an error which is returned when a CA certificate file can't be used.
+var ErrInvalidCACert = errors.New("invalid CA certificate")
+
+// ErrRelationshipsDropped is an error which is returned when the target doesn't keep a node's paragraph relationships.
+var ErrRelationshipsDropped = errors.New("the target dropped paragraph relationships")
+
+// ErrTitleTooLong is an error which is returned when a node title is longer than Drupal allows.
+var ErrTitleTooLong = errors.New("node title is too long")
+
+// ErrMissingID is an error which is returned when the target creates an entity but its response doesn't include the ID.
+var ErrMissingID = errors.New("the response did not include an ID")
+
+// ErrAPIError is an error which is returned when the Drupal API returns an unexpected error.
+var ErrAPIError = errors.New("an API error occurred")
+
+// Config holds the settings which control how hours are imported into the target.
+type Config struct {
+	// Target is the name of the server to POST hours to.
+	Target string
+	// Username is the username to use when authenticating with the target.
+	Username string
+	// Password is the password to use when authenticating with the target.
+	Password string
+	// FieldMap describes the content model and how the CSV columns map onto it.
+	FieldMap FieldMap
+	// MonthDelay is the amount of time to pause between processing each month.
+	MonthDelay time.Duration
+	// InputAuth is the optional "username:password" used to authenticate when fetching CSV files from a URL.
+	InputAuth string
+	// MaxDays is the number of days which can be imported without confirmation. Zero means no limit.
+	MaxDays int
+
+	// MinMonthDays is the number of days a month is expected to have at least, when more than one month
+	// is imported. Smaller months are warned about, or are an error with Strict. Zero disables the check.
+	MinMonthDays int
+	// ParagraphBatchSize is the number of paragraphs to create with each request. Zero creates them one at a time.
+	ParagraphBatchSize int
+	// MinTLSVersion is the lowest TLS version which will be negotiated with the target.
+	MinTLSVersion uint16
+	// SanitizeNotes removes disallowed HTML from notes before they are posted.
+	SanitizeNotes bool
+	// AllowedNoteTags is the set of HTML tags which are kept when sanitizing notes.
+	AllowedNoteTags map[string]bool
+	// ExpectContinue makes requests with a body wait for a 100 Continue response before sending it.
+	ExpectContinue bool
+	// StrictRelationships makes it an error for the target to drop any of a node's paragraph relationships.
+	StrictRelationships bool
+	// Sample creates only the first day of each month, in a node marked as a sample,
+	// so the rendering can be checked before doing the full import.
+	Sample bool
+	// TruncateTitle shortens node titles which are too long, instead of failing.
+	TruncateTitle bool
+	// CanonicalOut is the optional path of a CSV file to write the normalized hours to.
+	CanonicalOut string
+	// DateLayout is the Go time layout of the days in the day column.
+	DateLayout string
+	// Location is the time zone the days are parsed in. The local time zone is used if it is nil.
+	Location *time.Location
+	// DetectDateLayout detects the date layout of each file by trying DateLayouts against a sample of its days.
+	DetectDateLayout bool
+	// DateLayouts are the candidate Go time layouts tried when detecting the date layout.
+	DateLayouts []string
+	// ParagraphsOnly attaches paragraphs to existing nodes instead of creating new ones.
+	ParagraphsOnly bool
+	// NodeIDs optionally maps node titles to the IDs of the existing nodes used by ParagraphsOnly.
+	// If it is nil, the existing nodes are looked up by title.
+	NodeIDs map[string]string
+	// Trace logs the DNS, connect, TLS, and time to first byte durations of every request to the target.
+	Trace bool
+	// UseETag sends the node's ETag in an If-Match header when patching, so concurrent changes aren't lost.
+	UseETag bool
+	// IgnoreUnnamedColumns skips columns with an empty header, instead of failing.
+	IgnoreUnnamedColumns bool
+	// UpdateFields is the set of paragraph fields sent when a paragraph is patched. If nil, every field is sent.
+	UpdateFields map[string]bool
+	// Delimiter separates the fields of the CSV inputs. If zero, it is a comma.
+	Delimiter rune
+	// Comment starts the CSV lines which are skipped. If zero, no lines are skipped.
+	Comment rune
+	// InputEncoding is the encoding the CSV inputs are transcoded from. If nil, they must be UTF-8.
+	InputEncoding encoding.Encoding
+	// GroupBy is how the days are partitioned into nodes. The empty value groups them by month.
+	GroupBy Grouping
+
+	// AttemptOrder is the strategy used to sequence the requests which create each month's node and paragraphs.
+	AttemptOrder AttemptOrder
+	// PlanOut, if set, is the path a plan of the import is written to instead of importing.
+	PlanOut string
+	// MethodOverride sends PATCH and DELETE requests as POST requests with the method in MethodOverrideHeader.
+	MethodOverride bool
+	// Sparse requests only the fields the tool reads in the responses to POST and PATCH requests.
+	Sparse bool
+	// ManifestOut, if set, is the path a manifest of the days which weren't imported is written to if the import fails.
+	ManifestOut string
+	// ReimportManifest, if set, is the path of a manifest whose days are imported along with any CSV files.
+	ReimportManifest string
+	// Breaker pauses or aborts requests when the target returns consecutive server errors. If nil, it is disabled.
+	Breaker *CircuitBreaker
+	// Limiter spaces out requests to the target. If nil, requests aren't limited.
+	Limiter *rate.Limiter
+	// StructuredHoursLayout, if set, is the time layout used to parse building hours into structured open and close times.
+	StructuredHoursLayout string
+	// Redactor hides secrets from log output. If nil, nothing is redacted.
+	Redactor *Redactor
+	// WeekTemplate, if set, provides the hours of every day from RangeStart to RangeEnd, by day of the week.
+	// Days loaded from CSV files replace the template's hours for the same date.
+	WeekTemplate WeekTemplate
+	RangeStart   time.Time
+	RangeEnd     time.Time
+	// DryRun prints the requests which would change the target instead of sending them.
+	DryRun bool
+	// Scheme is the URL scheme used to reach the target, http or https. If empty, https is used.
+	Scheme string
+	// Concurrency is the number of paragraphs of a month created at the same time.
+	// Above one, each month's node is patched once, after all of its paragraphs exist.
+	Concurrency int
+	// MaxRetries is the number of times a request which fails with a transient error is retried.
+	MaxRetries int
+	// BearerToken, if set, authenticates requests to the target with an OAuth2 bearer token instead of basic auth.
+	BearerToken string
+
+	// APIKey, if set, authenticates requests to the target with an API key header instead of basic auth.
+	APIKey string
+
+	// APIKeyHeader is the header the API key is sent in. The empty value uses DefaultAPIKeyHeader.
+	APIKeyHeader string
+	// Timeout is how long each request may take before it is cancelled. If zero, RequestTimeout is used.
+	Timeout time.Duration
+	// SkipExisting skips months which already have a node with the same title, instead of creating a duplicate.
+	SkipExisting bool
+	// Update reuses the existing node for a month, replacing its paragraphs with the new ones.
+	Update bool
+	// Rollback records the nodes and paragraphs the import creates, so they can be deleted if it fails.
+	Rollback *Rollback
+	// StrictHours rejects building and chat hours which don't match hoursPattern.
+	StrictHours bool
+	// Verbose logs the method, URL, headers, and body of every request, and the status and body of every response.
+	Verbose bool
+	// AssumeYes skips the prompt to confirm the import before anything is written to the target.
+	AssumeYes bool
+	// Strict turns warnings about the input, like a file without any data lines, into errors.
+	Strict bool
+	// LastWins keeps the last occurrence of a day which appears more than once in the input, instead of failing.
+	LastWins bool
+	// ComposeHours is a template like "{open} - {close}" the building hours are composed with, from the open
+	// and close columns. If it is empty, the building hours are read from their own column.
+	ComposeHours string
+	// SkipUnchanged keeps the existing paragraphs of days whose contents haven't changed, in update mode.
+	SkipUnchanged bool
+	// KeepGoing records a month which fails and moves on to the next month, instead of stopping the import.
+	KeepGoing bool
+	// Logger receives a structured log line for each step of the import. If nil, only progress messages are written.
+	Logger *slog.Logger
+	// Confirm asks the operator a yes or no question, and returns true if they answer yes.
+	// If nil, every question is answered no.
+	Confirm func(question string) bool
+	// Progress receives progress messages. If nil, they are written to stdout.
+	Progress *Progress
+	// Client is the HTTP client used for every request. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// HoursByDayParagraph is the struct compliment of the required JSON for an hours by day paragraph.
+type HoursByDayParagraph struct {
+	Data struct {
+		Type          string              `json:"type"`
+		ID            string              `json:"id,omitempty"`
+		Attributes    ParagraphAttributes `json:"attributes"`
+		Relationships *ParagraphReference `json:"relationships,omitempty"`
+	} `json:"data"`
+}
+
+// ParagraphReference is a paragraph's optional reference to another node,
+// which is marshalled using the field's machine name as the key.
+type ParagraphReference struct {
+	Name string
+	Type string
+	ID   string
+}
+
+// MarshalJSON marshals the reference as a JSON:API to-one relationship.
+func (r ParagraphReference) MarshalJSON() ([]byte, error) {
+	d := map[string]map[string]string{"data": {"type": r.Type, "id": r.ID}}
+	return json.Marshal(map[string]interface{}{r.Name: d})
+}
+
+// UnmarshalJSON ignores the paragraph's relationships in the server's response, which the tool doesn't need.
+func (r *ParagraphReference) UnmarshalJSON([]byte) error {
+	return nil
+}
+
+// ParagraphAttributes are the attributes of an hours by day paragraph.
+// The field values are marshalled using the machine names in Fields, so they aren't struct tags.
+type ParagraphAttributes struct {
+	DrupalInternalID         int
+	DrupalInternalRevisionID int
+	ParentID                 string
+	ParentType               string
+	ParentFieldName          string
+	BuildingHours            string
+	BuildingOpen             string
+	BuildingClose            string
+	ChatHours                string
+	Day                      string
+	Note                     string
+	Holiday                  bool
+	// Extra holds the values of additional fields, keyed by machine name.
+	Extra map[string]string
+	// Fields are the machine names the values above are marshalled with.
+	Fields ParagraphFields
+}
+
+// MarshalJSON marshals the attributes using the configured field machine names.
+func (a ParagraphAttributes) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{
+		"parent_id":         a.ParentID,
+		"parent_type":       a.ParentType,
+		"parent_field_name": a.ParentFieldName,
+	}
+
+	if a.DrupalInternalID != 0 {
+		m["drupal_internal__id"] = a.DrupalInternalID
+	}
+
+	if a.DrupalInternalRevisionID != 0 {
+		m["drupal_internal__revision_id"] = a.DrupalInternalRevisionID
+	}
+
+	for name, value := range a.Extra {
+		m[name] = value
+	}
+
+	// Fields without a machine name are left out, as is an empty day.
+	if a.Fields.BuildingHours != "" {
+		m[a.Fields.BuildingHours] = a.BuildingHours
+	}
+
+	// Structured times are only sent when the building hours were parsed into them.
+	if a.Fields.BuildingOpen != "" && a.BuildingOpen != "" {
+		m[a.Fields.BuildingOpen] = a.BuildingOpen
+	}
+
+	if a.Fields.BuildingClose != "" && a.BuildingClose != "" {
+		m[a.Fields.BuildingClose] = a.BuildingClose
+	}
+
+	if a.Fields.ChatHours != "" {
+		m[a.Fields.ChatHours] = a.ChatHours
+	}
+
+	if a.Fields.Note != "" {
+		m[a.Fields.Note] = a.Note
+	}
+
+	if a.Fields.Holiday != "" {
+		m[a.Fields.Holiday] = a.Holiday
+	}
+
+	if a.Fields.Day != "" && a.Day != "" {
+		m[a.Fields.Day] = a.Day
+	}
+
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON unmarshals the attributes the tool needs from the server's response.
+// The field values are left alone, since the server may return them in a richer form than was sent.
+func (a *ParagraphAttributes) UnmarshalJSON(b []byte) error {
+	m := map[string]json.RawMessage{}
+
+	err := json.Unmarshal(b, &m)
+	if err != nil {
+		return err
+	}
+
+	targets := map[string]interface{}{
+		"drupal_internal__id":          &a.DrupalInternalID,
+		"drupal_internal__revision_id": &a.DrupalInternalRevisionID,
+		"parent_id":                    &a.ParentID,
+		"parent_type":                  &a.ParentType,
+		"parent_field_name":            &a.ParentFieldName,
+	}
+
+	for key, target := range targets {
+		raw, ok := m[key]
+		if !ok {
+			continue
+		}
+
+		err := json.Unmarshal(raw, target)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewHoursByDayParagraph creates a new NewHoursByDayParagraph struct from one day's hours.
+// The field map provides the paragraph type and field machine names.
+func NewHoursByDayParagraph(parentID string, h DailyHours, fm FieldMap) HoursByDayParagraph {
+	p := HoursByDayParagraph{}
+	p.Data.Type = fm.ParagraphType
+	p.Data.Attributes.Fields = fm.Fields
+	p.Data.Attributes.ParentID = parentID
+	p.Data.Attributes.ParentType = "node"
+	p.Data.Attributes.ParentFieldName = fm.ParentField
+	p.Data.Attributes.BuildingHours = strings.TrimSpace(h.BuildingHours)
+	p.Data.Attributes.BuildingOpen = h.BuildingOpen
+	p.Data.Attributes.BuildingClose = h.BuildingClose
+	p.Data.Attributes.ChatHours = strings.TrimSpace(h.ChatHours)
+	p.Data.Attributes.Day = h.Day.Format("2006-01-02")
+	p.Data.Attributes.Note = strings.TrimSpace(h.Note)
+	p.Data.Attributes.Holiday = h.Holiday
+
+	if fm.ReferenceField != "" && h.Reference != "" {
+		p.Data.Relationships = &ParagraphReference{Name: fm.ReferenceField, Type: fm.ReferenceType, ID: h.Reference}
+	}
+
+	if len(h.Extra) > 0 {
+		p.Data.Attributes.Extra = map[string]string{}
+
+		for name, value := range h.Extra {
+			p.Data.Attributes.Extra[name] = strings.TrimSpace(value)
+		}
+	}
+
+	return p
+}
+
+// Post uses the JSON API endpoint at target to create the new paragraph.
+func (p *HoursByDayParagraph) Post(ctx context.Context, cfg Config) error {
+	url := sparseParagraphURL(fmt.Sprintf("%v%v", cfg.BaseURL(), cfg.FieldMap.ParagraphPath), cfg)
+	return p.doAPICall(ctx, cfg, url, http.MethodPost)
+}
+
+// Patch uses the JSON API endpoint at target to update the paragraph.
+// Only the fields in cfg.UpdateFields are sent, so the others are left untouched in Drupal.
+func (p *HoursByDayParagraph) Patch(ctx context.Context, cfg Config) error {
+	url := sparseParagraphURL(fmt.Sprintf("%v%v/%v", cfg.BaseURL(), cfg.FieldMap.ParagraphPath, p.Data.ID), cfg)
+
+	u := *p
+	u.Data.Attributes.Fields = p.Data.Attributes.Fields.Restrict(cfg.UpdateFields)
+
+	if cfg.UpdateFields != nil {
+		// The reference isn't one of the fields which can be selected, so it is left as it is.
+		u.Data.Relationships = nil
+		u.Data.Attributes.Extra = map[string]string{}
+
+		for name, value := range p.Data.Attributes.Extra {
+			if cfg.UpdateFields[name] {
+				u.Data.Attributes.Extra[name] = value
+			}
+		}
+	}
+
+	err := u.doAPICall(ctx, cfg, url, http.MethodPatch)
+
+	// Keep the full set of fields and values, updating only what the server returned.
+	u.Data.Attributes.Fields = p.Data.Attributes.Fields
+	u.Data.Attributes.Extra = p.Data.Attributes.Extra
+	u.Data.Relationships = p.Data.Relationships
+	*p = u
+
+	return err
+}
+
+// Delete uses the JSON API endpoint at target to delete the paragraph.
+func (p *HoursByDayParagraph) Delete(ctx context.Context, cfg Config) error {
+	url := fmt.Sprintf("%v%v/%v", cfg.BaseURL(), cfg.FieldMap.ParagraphPath, p.Data.ID)
+	_, err := callAPI(ctx, cfg, url, http.MethodDelete, nil, nil)
+
+	return err
+}
+
+// doAPICall calls the API using the provided method, updating the paragraph from the response.
+// Relationships can't be built without an ID, so a created paragraph must have one.
+func (p *HoursByDayParagraph) doAPICall(ctx context.Context, cfg Config, url, method string) error {
+	_, err := callAPI(ctx, cfg, url, method, p, nil)
+	if err != nil {
+		return err
+	}
+
+	if method == http.MethodPost && p.Data.ID == "" {
+		return fmt.Errorf("%w: %v %v", ErrMissingID, method, url)
+	}
+
+	if method == http.MethodPost && !cfg.DryRun {
+		cfg.Rollback.AddParagraph(p.Data.ID)
+	}
+
+	return nil
+}
+
+// HoursNode is the struct compliment of the required JSON for an hours node.
+type HoursNode struct {
+	Data struct {
+		Type          string         `json:"type"`
+		ID            string         `json:"id,omitempty"`
+		Attributes    NodeAttributes `json:"attributes"`
+		Relationships ParagraphField `json:"relationships"`
+	} `json:"data"`
+	// etag is the node's ETag from the last response which included one.
+	etag string
+}
+
+// NodeAttributes are the attributes of an hours node.
+type NodeAttributes struct {
+	Title string
+	// DrupalInternalNID is the node's numeric ID, used in its canonical URL. It is read from responses, never sent.
+	DrupalInternalNID int
+}
+
+// nodeAttributesData is the JSON representation of NodeAttributes sent to the target.
+type nodeAttributesData struct {
+	Title string `json:"title"`
+}
+
+// MarshalJSON marshals the attributes the tool sends, leaving out the read-only node ID.
+func (a NodeAttributes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(nodeAttributesData{Title: a.Title})
+}
+
+// UnmarshalJSON unmarshals the title and node ID from the server's response.
+func (a *NodeAttributes) UnmarshalJSON(b []byte) error {
+	d := struct {
+		Title             string `json:"title"`
+		DrupalInternalNID int    `json:"drupal_internal__nid"`
+	}{}
+
+	err := json.Unmarshal(b, &d)
+	if err != nil {
+		return err
+	}
+
+	a.Title = d.Title
+	a.DrupalInternalNID = d.DrupalInternalNID
+
+	return nil
+}
+
+// NodeURL returns the node's canonical URL on the target, or its JSON:API URL if the node ID isn't known.
+func (n HoursNode) NodeURL(cfg Config) string {
+	if n.Data.Attributes.DrupalInternalNID != 0 {
+		return fmt.Sprintf("%v/node/%v", cfg.BaseURL(), n.Data.Attributes.DrupalInternalNID)
+	}
+
+	return fmt.Sprintf("%v%v/%v", cfg.BaseURL(), cfg.FieldMap.NodePath, n.Data.ID)
+}
+
+// ParagraphField is the node's paragraph reference field, which is marshalled using its machine name as the key.
+type ParagraphField struct {
+	Name string
+	Data []ParagraphRelationship
+}
+
+// paragraphFieldData is the JSON representation of the contents of a ParagraphField.
+type paragraphFieldData struct {
+	Data []ParagraphRelationship `json:"data"`
+}
+
+// MarshalJSON marshals the field as an object with a single key, the field's machine name.
+func (f ParagraphField) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]paragraphFieldData{f.Name: {Data: f.Data}})
+}
+
+// UnmarshalJSON unmarshals the relationship with the field's machine name, ignoring any other relationships.
+func (f *ParagraphField) UnmarshalJSON(b []byte) error {
+	m := map[string]json.RawMessage{}
+
+	err := json.Unmarshal(b, &m)
+	if err != nil {
+		return err
+	}
+
+	raw, ok := m[f.Name]
+	if !ok {
+		return nil
+	}
+
+	d := paragraphFieldData{}
+
+	err = json.Unmarshal(raw, &d)
+	if err != nil {
+		return err
+	}
+
+	f.Data = d.Data
+
+	return nil
+}
+
+// ParagraphRelationship contains the data linking the node to the paragraph.
+type ParagraphRelationship struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Meta struct {
+		TargetRevisionID int `json:"target_revision_id"`
+	} `json:"meta"`
+}
+
+// NewHoursNode creates a new HoursNode struct.
+// The field map provides the node type and the machine name of the node's paragraph reference field.
+func NewHoursNode(title string, fm FieldMap) HoursNode {
+	n := HoursNode{}
+	n.Data.Type = fm.NodeType
+	n.Data.Attributes.Title = strings.TrimSpace(title)
+	n.Data.Relationships.Name = fm.NodeField
+
+	return n
+}
+
+// NewParagraphRelationship creates a new ParagraphRelationship.
+func NewParagraphRelationship(pType, pID string, targetRevisionID int) ParagraphRelationship {
+	p := ParagraphRelationship{}
+	p.Type = pType
+	p.ID = pID
+	p.Meta.TargetRevisionID = targetRevisionID
+
+	return p
+}
+
+// Post uses the JSON API endpoint at target to create the new node.
+func (n *HoursNode) Post(ctx context.Context, cfg Config) error {
+	url := sparseNodeURL(fmt.Sprintf("%v%v", cfg.BaseURL(), cfg.FieldMap.NodePath), cfg)
+	return n.doAPICall(ctx, cfg, url, http.MethodPost)
+}
+
+// Patch uses the JSON API endpoint at target to update the new node.
+func (n *HoursNode) Patch(ctx context.Context, cfg Config) error {
+	url := sparseNodeURL(fmt.Sprintf("%v%v/%v", cfg.BaseURL(), cfg.FieldMap.NodePath, n.Data.ID), cfg)
+	return n.doAPICall(ctx, cfg, url, http.MethodPatch)
+}
+
+// Delete uses the JSON API endpoint at target to delete the node.
+func (n *HoursNode) Delete(ctx context.Context, cfg Config) error {
+	url := fmt.Sprintf("%v%v/%v", cfg.BaseURL(), cfg.FieldMap.NodePath, n.Data.ID)
+	_, err := callAPI(ctx, cfg, url, http.MethodDelete, nil, nil)
+
+	return err
+}
+
+// doAPICall calls the API using the provided method, updating the node from the response.
+// Paragraphs can't be parented without an ID, so a created node must have one.
+// With UseETag set, the node's ETag is recorded from responses and sent in an If-Match header when patching.
+func (n *HoursNode) doAPICall(ctx context.Context, cfg Config, url, method string) error {
+	h := http.Header{}
+	if cfg.UseETag && method == http.MethodPatch && n.etag != "" {
+		h.Set("If-Match", n.etag)
+	}
+
+	rh, err := callAPI(ctx, cfg, url, method, n, h)
+	if err != nil {
+		return err
+	}
+
+	if method == http.MethodPost && n.Data.ID == "" {
+		return fmt.Errorf("%w: %v %v", ErrMissingID, method, url)
+	}
+
+	if method == http.MethodPost && !cfg.DryRun {
+		cfg.Rollback.AddNode(n.Data.ID)
+	}
+
+	if etag := rh.Get("ETag"); etag != "" {
+		n.etag = etag
+	}
+
+	return nil
+}
+
+// marshalBody marshals v into a request body which is byte-stable across runs.
+// encoding/json writes struct fields in declaration order and sorts map keys,
+// so any dynamic fields stored in maps are also written in a canonical order.
+func marshalBody(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// DailyHours stores the data from the CSV file, the source data for the Drupal paragraphs.
+type DailyHours struct {
+	Day           time.Time
+	Note          string
+	BuildingHours string
+	// BuildingOpen and BuildingClose are the building hours as structured times, if they are parsed.
+	BuildingOpen  string
+	BuildingClose string
+	ChatHours     string
+	// Holiday marks the day as a holiday, so the theme can style it differently.
+	Holiday bool
+	// NodeTitle, if set, overrides the month-based title of the node the day is grouped into.
+	NodeTitle string
+	// Reference is the UUID of a node the paragraph's reference field points at.
+	Reference string
+	// Extra holds the values of additional paragraph fields, keyed by machine name.
+	Extra map[string]string
+}
+
+// Process imports the hours from the arguments, which are CSV files, URLs of CSV files, or StdinArg, into the target.
+// It returns a summary of what was created, even if an error occurs partway through.
+// Cancelling the context stops the import before its next request.
+func Process(ctx context.Context, args []string, cfg Config) (result Result, err error) {
+	// Keep track of how long the import takes, for reporting.
+	start := time.Now()
+
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	hours, nodeIDs, err := LoadHours(ctx, args, cfg)
+	if err != nil {
+		return result, err
+	}
+
+	return ImportHours(ctx, hours, nodeIDs, cfg)
+}
+
+// LoadHours loads and normalizes the hours from the arguments, and the manifest being re-imported, if there is one.
+// It returns the days to import, and a map of node titles to the IDs of the nodes a re-imported manifest's days belong to.
+// The hours can then be imported into more than one target with ImportHours.
+func LoadHours(ctx context.Context, args []string, cfg Config) (hours []DailyHours, nodeIDs map[string]string, err error) {
+	hours = []DailyHours{}
+
+	// Re-import the days a failed import didn't finish.
+	nodeIDs = map[string]string{}
+
+	if cfg.ReimportManifest != "" {
+		hours, nodeIDs, err = LoadManifest(cfg.ReimportManifest, cfg.Target, cfg.location())
+		if err != nil {
+			return hours, nodeIDs, err
+		}
+	}
+
+	// Load input from CSV files or URLs.
+	for _, arg := range args {
+		var h []DailyHours
+
+		if isURL(arg) {
+			h, err = loadFromURL(ctx, arg, cfg)
+		} else {
+			h, err = loadFromCSV(arg, cfg)
+		}
+
+		if err != nil {
+			return hours, nodeIDs, err
+		}
+
+		hours = append(hours, h...)
+	}
+
+	// The same day in overlapping files would otherwise be listed twice.
+	hours, err = dedupeDays(hours, cfg.LastWins)
+	if err != nil {
+		return hours, nodeIDs, err
+	}
+
+	// Fill the range from the week template, with the days from the CSV files as exceptions.
+	if cfg.WeekTemplate != nil {
+		hours = applyOverrides(cfg.WeekTemplate.Expand(cfg.RangeStart, cfg.RangeEnd), hours)
+	}
+
+	// Remove unsafe HTML from the notes.
+	if cfg.SanitizeNotes {
+		for i := range hours {
+			hours[i].Note = SanitizeHTML(hours[i].Note, cfg.AllowedNoteTags)
+		}
+	}
+
+	// Record exactly what is going to be sent, after all normalization.
+	if cfg.CanonicalOut != "" {
+		err = WriteCanonicalCSV(cfg.CanonicalOut, hours)
+		if err != nil {
+			return hours, nodeIDs, fmt.Errorf("writing canonical CSV '%v' failed, %w", cfg.CanonicalOut, err)
+		}
+	}
+
+	// A month with very few days is usually a mistyped date.
+	err = checkSmallMonths(hours, nodeIDs, cfg)
+	if err != nil {
+		return hours, nodeIDs, err
+	}
+
+	// Guard against accidentally importing far more days than expected.
+	if cfg.MaxDays > 0 && len(hours) > cfg.MaxDays {
+		q := fmt.Sprintf("Loaded %v days, which is more than the maximum of %v. Continue?", len(hours), cfg.MaxDays)
+		if !cfg.confirm(q) {
+			return hours, nodeIDs, fmt.Errorf("%w: loaded %v days, the maximum is %v", ErrTooManyDays, len(hours), cfg.MaxDays)
+		}
+	}
+
+	return hours, nodeIDs, nil
+}
+
+// ImportHours imports the days loaded by LoadHours into the target.
+// The node IDs map node titles to the IDs of existing nodes the days of those months are attached to.
+// It returns a summary of what was created, even if an error occurs partway through.
+func ImportHours(ctx context.Context, hours []DailyHours, nodeIDs map[string]string, cfg Config) (result Result, err error) {
+	// Keep track of how long the import takes, for reporting.
+	start := time.Now()
+
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	// Partition the days by month or week, or by node title where rows override it.
+	months := groupByTitle(hours, cfg.FieldMap.TitleFormat, cfg.GroupBy)
+
+	// The titles each month's node was given, for the manifest.
+	titles := map[string]string{}
+
+	// If the import fails, record the days which weren't imported so a later run can finish them.
+	if cfg.ManifestOut != "" {
+		defer func() {
+			if err == nil {
+				return
+			}
+
+			werr := WriteManifest(cfg.ManifestOut, NewManifest(cfg.Target, months, titles, result))
+			if werr != nil {
+				err = fmt.Errorf("%w (writing manifest '%v' also failed, %v)", err, cfg.ManifestOut, werr)
+				return
+			}
+
+			cfg.progress().Printf("\nWrote the days which weren't imported to '%v'.\n", cfg.ManifestOut)
+		}()
+	}
+
+	// Write the plan for review instead of importing.
+	if cfg.PlanOut != "" {
+		err = WritePlan(ctx, cfg.PlanOut, months, nodeIDs, cfg)
+		if err != nil {
+			return result, fmt.Errorf("writing plan '%v' failed, %w", cfg.PlanOut, err)
+		}
+
+		return result, nil
+	}
+
+	// Make sure the operator meant to write to this target, since the default is the production site.
+	if !cfg.AssumeYes && !cfg.DryRun {
+		q := fmt.Sprintf("You are about to import %v days in %v months into %v. Continue?", len(hours), len(months), cfg.BaseURL())
+		if !cfg.confirm(q) {
+			return result, fmt.Errorf("%w, answer yes at the prompt or set -yes", ErrNotConfirmed)
+		}
+	}
+
+	// For every month, we create the 'container' node, then the containing paragraphs
+	// which are then patched in.
+	first := true
+
+	// The number of the month being imported, for the status line.
+	monthNum := 0
+
+	// Without a strategy, each node is patched once, after all of its paragraphs exist,
+	// rather than creating a revision of the node for every batch.
+	order := cfg.AttemptOrder
+	if order == "" {
+		order = AttemptOrderBulk
+	}
+
+	// Paragraphs created concurrently are linked with a single PATCH once they all exist.
+	if cfg.Concurrency > 1 && order == AttemptOrderIncremental {
+		order = AttemptOrderBulk
+	}
+
+	// Assume the target supports creating paragraphs in batches until it says otherwise.
+	// The requests of a dry run are printed one paragraph at a time, and concurrent
+	// paragraphs are created with their own requests.
+	batchSupported := cfg.ParagraphBatchSize > 1 && !cfg.DryRun && cfg.Concurrency <= 1
+
+	for month, dailyHours := range months {
+		// Pause between months to give the server time to catch up.
+		if !first && cfg.MonthDelay > 0 {
+			err := sleep(ctx, cfg.MonthDelay)
+			if err != nil {
+				return result, fmt.Errorf("%w, interrupted between months after %v of %v", err, monthNum, len(months))
+			}
+		}
+
+		first = false
+		monthNum++
+
+		// Where the month's import has got to, in case it is interrupted.
+		step := monthStep{Title: month, Step: "starting"}
+
+		// With -keep-going, a month which fails is recorded and the import moves on to the next month.
+		err := func() error {
+			title, dailyHours, err := monthTitle(month, dailyHours, cfg)
+			if err != nil {
+				return err
+			}
+
+			step.Title = title
+
+			cfg.progress().Printf("%v...", title)
+			cfg.LogEvent(slog.LevelInfo, "month started", "month", title, "days", len(dailyHours))
+
+			monthStart := time.Now()
+
+			titles[month] = title
+
+			// Decide what to do with the month, the same way a plan does.
+			plan, err := planMonth(ctx, cfg, title, dailyHours, nodeIDs, &step)
+			if err != nil {
+				return err
+			}
+
+			if plan.Skip {
+				cfg.progress().Printf(" Skipped, a node with this title already exists\n")
+				cfg.LogEvent(slog.LevelInfo, "month skipped", "month", title, "reason", "node exists")
+				return nil
+			}
+
+			if len(plan.Kept) > 0 {
+				cfg.progress().Printf(" (%v unchanged days kept)", len(plan.Kept))
+			}
+
+			if len(plan.Patched) > 0 {
+				cfg.progress().Printf(" (%v existing days patched)", len(plan.Patched))
+			}
+
+			if plan.Duplicates > 0 {
+				cfg.progress().Printf(" (warning: %v node(s) with this title already exist, creating another)", plan.Duplicates)
+				cfg.LogEvent(slog.LevelWarn, "duplicate node title", "month", title, "existing_nodes", plan.Duplicates)
+			}
+
+			n := plan.Node
+			dailyHours = plan.Days
+			existing, updating, reimported := plan.Existing, plan.Updating, plan.Reimported
+			replaced, kept := plan.Replaced, plan.Kept
+
+			// With the paragraphs first, the node is created once they all exist.
+			nodeFirst := order != AttemptOrderParagraphsFirst || existing
+
+			step.Step = "preparing the node"
+
+			// Paragraphs are attached to existing nodes, or to a new node.
+			switch {
+			case cfg.ParagraphsOnly, updating:
+				// The node was already looked up.
+			case reimported:
+				err = n.Get(ctx, cfg)
+			case nodeFirst:
+				err = n.Post(ctx, cfg)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if nodeFirst {
+				step.NodeID = n.Data.ID
+				result.Nodes = append(result.Nodes, NodeResult{Title: title, ID: n.Data.ID,
+					InternalID: n.Data.Attributes.DrupalInternalNID, Existing: existing})
+				cfg.LogEvent(slog.LevelInfo, "node ready", "month", title, "node_id", n.Data.ID, "existing", existing)
+			}
+
+			paragraphs := []ParagraphResult{}
+
+			// Concurrent paragraphs are all created at once, then linked in order by day.
+			batchSize := cfg.ParagraphBatchSize
+
+			if cfg.Concurrency > 1 {
+				batchSize = len(dailyHours)
+			}
+
+			// An unset batch size creates the paragraphs one at a time.
+			if batchSize < 1 {
+				batchSize = 1
+			}
+
+			for batchStart := 0; batchStart < len(dailyHours); batchStart += batchSize {
+				// Has our context been cancelled?
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+
+				end := batchStart + batchSize
+				if end > len(dailyHours) {
+					end = len(dailyHours)
+				}
+
+				cfg.progress().Status("[%v/%v months] creating paragraph %v/%v", monthNum, len(months), end, len(dailyHours))
+
+				step.Step = "creating paragraphs"
+				step.Day = dailyHours[batchStart].Day.Format("2006-01-02")
+
+				batch := []HoursByDayParagraph{}
+
+				for _, h := range dailyHours[batchStart:end] {
+					batch = append(batch, NewHoursByDayParagraph(n.Data.ID, h, cfg.FieldMap))
+				}
+
+				err := postParagraphs(ctx, batch, cfg, &batchSupported)
+				if err != nil {
+					return err
+				}
+
+				created := 0
+
+				for _, p := range batch {
+					// A paragraph without an ID wasn't created, so there is nothing to link.
+					if p.Data.ID == "" {
+						continue
+					}
+
+					r := NewParagraphRelationship(p.Data.Type, p.Data.ID, p.Data.Attributes.DrupalInternalRevisionID)
+					n.Data.Relationships.Data = append(n.Data.Relationships.Data, r)
+					created++
+				}
+
+				step.Created += created
+
+				for i, p := range batch {
+					if p.Data.ID == "" {
+						continue
+					}
+
+					paragraphs = append(paragraphs, ParagraphResult{
+						Day:        dailyHours[batchStart+i].Day.Format("2006-01-02"),
+						ID:         p.Data.ID,
+						InternalID: p.Data.Attributes.DrupalInternalID,
+						RevisionID: p.Data.Attributes.DrupalInternalRevisionID,
+					})
+				}
+
+				// The node's result is updated as paragraphs are created, so they can be deleted if the import fails.
+				if nodeFirst {
+					result.Nodes[len(result.Nodes)-1].Paragraphs = paragraphs
+				}
+
+				if order == AttemptOrderIncremental && created > 0 {
+					step.Step = "patching the node"
+
+					err = patchNode(ctx, &n, cfg)
+					if err != nil {
+						return err
+					}
+
+					step.Linked = step.Created
+					markLinked(paragraphs)
+				}
+			}
+
+			// Days which already have a paragraph patch it, then the node is relinked to its new revision.
+			for _, pp := range plan.Patched {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+
+				step.Step = "patching paragraphs"
+				step.Day = pp.Day.Day.Format("2006-01-02")
+
+				r, err := pp.patch(ctx, n.Data.ID, cfg)
+				if err != nil {
+					return err
+				}
+
+				n.Data.Relationships.Data = append(n.Data.Relationships.Data, r)
+			}
+
+			// The node is relinked if there are new paragraphs, if kept paragraphs replace some of the old ones,
+			// or if existing paragraphs were patched.
+			// Patching the node without any new or kept paragraphs could clear an existing node's relationships.
+			relink := len(paragraphs) > 0 || plan.relinksExisting()
+
+			if !relink && nodeFirst {
+				cfg.progress().Printf(" (no paragraphs were created, the node was left untouched)")
+			}
+
+			// Kept, patched, and new paragraphs are linked in calendar order.
+			if len(kept) > 0 || len(plan.Patched) > 0 {
+				days := map[string]string{}
+				for day, r := range kept {
+					days[r.ID] = day
+				}
+
+				for _, pp := range plan.Patched {
+					days[pp.Relationship.ID] = pp.Day.Day.Format("2006-01-02")
+				}
+
+				for _, pr := range paragraphs {
+					days[pr.ID] = pr.Day
+				}
+
+				sortRelationships(n.Data.Relationships.Data, days)
+			}
+
+			step.Day = ""
+
+			switch {
+			case !nodeFirst:
+				step.Step = "creating the node"
+
+				err = n.Post(ctx, cfg)
+				if err == nil {
+					markLinked(paragraphs)
+					step.NodeID = n.Data.ID
+					result.Nodes = append(result.Nodes, NodeResult{Title: title, ID: n.Data.ID,
+						InternalID: n.Data.Attributes.DrupalInternalNID, Paragraphs: paragraphs})
+				}
+			case relink && (order != AttemptOrderIncremental || len(kept) > 0 || len(plan.Patched) > 0):
+				step.Step = "patching the node"
+
+				err = patchNode(ctx, &n, cfg)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			step.Linked = step.Created
+			markLinked(paragraphs)
+
+			// Once the node only references the new and kept paragraphs, the ones they replaced can be deleted.
+			if updating && relink {
+				step.Step = "deleting the replaced paragraphs"
+
+				err = deleteReplaced(ctx, cfg, replaced)
+				if err != nil {
+					return err
+				}
+			}
+
+			result.Nodes[len(result.Nodes)-1].Duration = time.Since(monthStart)
+
+			cfg.progress().Printf(" Success\n")
+
+			// Link to the node, so it can be spot-checked. Dry runs don't have a real node to link to.
+			if !cfg.DryRun {
+				verb := "Created"
+				if existing || updating {
+					verb = "Updated"
+				}
+
+				cfg.progress().Printf("%v %v -> %v\n", verb, title, n.NodeURL(cfg))
+			}
+
+			cfg.LogEvent(slog.LevelInfo, "month imported", "month", title, "node_id", n.Data.ID,
+				"paragraphs", len(paragraphs), "duration", time.Since(monthStart).String())
+
+			return nil
+		}()
+		if err != nil {
+			// A cancelled import stops, even when going past failed months, and reports what it was doing.
+			if ctx.Err() != nil {
+				return result, fmt.Errorf("%w, %v", err, step.interrupted())
+			}
+
+			if !cfg.KeepGoing {
+				return result, err
+			}
+
+			title, ok := titles[month]
+			if !ok {
+				title = month
+			}
+
+			cfg.progress().Printf(" Failed: %v\n", err)
+			cfg.LogEvent(slog.LevelError, "month failed", "month", title, "error", err.Error())
+			result.Failed = append(result.Failed, MonthFailure{Title: title, Err: err})
+		}
+	}
+
+	if len(result.Failed) > 0 {
+		return result, fmt.Errorf("%w: %v of %v months", ErrMonthsFailed, len(result.Failed), len(months))
+	}
+
+	return result, nil
+}
+
+// markLinked records that the node references the paragraphs, so their days count as imported.
+func markLinked(paragraphs []ParagraphResult) {
+	for i := range paragraphs {
+		paragraphs[i].Linked = true
+	}
+}
+
+// monthTitle returns the title of the month's node, and the days which go in it.
+// Samples only include the first day, and are clearly titled as samples.
+func monthTitle(month string, days []DailyHours, cfg Config) (string, []DailyHours, error) {
+	// Paragraphs are created and linked in calendar order, whatever order the input was in.
+	sort.SliceStable(days, func(i, j int) bool {
+		return days[i].Day.Before(days[j].Day)
+	})
+
+	title := month
+	if cfg.Sample {
+		title = SampleTitlePrefix + month
+		days = days[:1]
+	}
+
+	title, err := checkTitle(title, cfg.TruncateTitle)
+
+	return title, days, err
+}
+
+// deleteReplaced deletes the paragraphs an updated node referenced before the update.
+func deleteReplaced(ctx context.Context, cfg Config, replaced []ParagraphRelationship) error {
+	for _, r := range replaced {
+		// Only paragraphs of the hours by day type were created by the tool.
+		if r.Type != cfg.FieldMap.ParagraphType {
+			continue
+		}
+
+		p := HoursByDayParagraph{}
+		p.Data.Type = r.Type
+		p.Data.ID = r.ID
+
+		err := p.Delete(ctx, cfg)
+		if err != nil {
+			return fmt.Errorf("deleting replaced paragraph '%v' failed, %w", r.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// checkTitle checks that the title fits in a Drupal node title.
+// Titles which are too long are an error, unless truncate is set, in which case they are shortened with an ellipsis.
+func checkTitle(title string, truncate bool) (string, error) {
+	r := []rune(title)
+	if len(r) <= MaxTitleLength {
+		return title, nil
+	}
+
+	if !truncate {
+		return title, fmt.Errorf("%w: '%v' is %v characters, the maximum is %v",
+			ErrTitleTooLong, title, len(r), MaxTitleLength)
+	}
+
+	return string(r[:MaxTitleLength-1]) + "…", nil
+}
+
+// DeleteCreated deletes the paragraphs, then the nodes, described by the result.
+// Nodes which existed before the import are left alone.
+func DeleteCreated(ctx context.Context, cfg Config, result Result) error {
+	for _, nr := range result.Nodes {
+		for _, pr := range nr.Paragraphs {
+			p := HoursByDayParagraph{}
+			p.Data.ID = pr.ID
+
+			err := p.Delete(ctx, cfg)
+			if err != nil {
+				return err
+			}
+		}
+
+		if nr.Existing {
+			continue
+		}
+
+		n := NewHoursNode(nr.Title, cfg.FieldMap)
+		n.Data.ID = nr.ID
+
+		err := n.Delete(ctx, cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// patchNode patches the node's relationships, then checks that the target kept all of them.
+// Missing relationships are reported, and are an error if StrictRelationships is set.
+// With UseETag set, a PATCH rejected because the node changed is retried against a fresh copy of the node.
+func patchNode(ctx context.Context, n *HoursNode, cfg Config) error {
+	sent := append([]ParagraphRelationship{}, n.Data.Relationships.Data...)
+
+	for attempt := 1; ; attempt++ {
+		err := n.Patch(ctx, cfg)
+		if err == nil {
+			break
+		}
+
+		if !cfg.UseETag || !hasStatus(err, http.StatusPreconditionFailed) || attempt == MaxETagAttempts {
+			return err
+		}
+
+		// Someone else changed the node, so re-fetch it and add our paragraphs to its current relationships.
+		fresh := NewHoursNode(n.Data.Attributes.Title, cfg.FieldMap)
+		fresh.Data.ID = n.Data.ID
+
+		err = fresh.Get(ctx, cfg)
+		if err != nil {
+			return err
+		}
+
+		fresh.Data.Relationships.Data = append(fresh.Data.Relationships.Data,
+			missingRelationships(sent, fresh.Data.Relationships.Data)...)
+		*n = fresh
+		sent = append([]ParagraphRelationship{}, n.Data.Relationships.Data...)
+	}
+
+	missing := missingRelationships(sent, n.Data.Relationships.Data)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	ids := []string{}
+	for _, r := range missing {
+		ids = append(ids, r.ID)
+	}
+
+	if cfg.StrictRelationships {
+		return fmt.Errorf("%w: '%v' is missing paragraphs %v",
+			ErrRelationshipsDropped, n.Data.Attributes.Title, strings.Join(ids, ", "))
+	}
+
+	log.Printf("Warning: the target dropped %v paragraph relationships from '%v': %v.\n",
+		len(missing), n.Data.Attributes.Title, strings.Join(ids, ", "))
+
+	return nil
+}
+
+// missingRelationships returns the relationships in sent which aren't in got.
+func missingRelationships(sent, got []ParagraphRelationship) []ParagraphRelationship {
+	kept := map[string]bool{}
+	for _, r := range got {
+		kept[r.ID] = true
+	}
+
+	missing := []ParagraphRelationship{}
+
+	for _, r := range sent {
+		if !kept[r.ID] {
+			missing = append(missing, r)
+		}
+	}
+
+	return missing
+}
+
+// groupByTitle partitions the days by the title of the node they belong to.
+// That is the month or week the day falls in, built using the title format, unless the day has its own node title.
+// Days are grouped using the calendar date in the location they were parsed in,
+// so leap days and the first and last days of a month are never shifted into a
+// neighbouring month by a conversion to another time zone.
+func groupByTitle(hours []DailyHours, format string, grouping Grouping) map[string][]DailyHours {
+	months := map[string][]DailyHours{}
+
+	for _, h := range hours {
+		title := groupTitle(h.Day, format, grouping)
+		if h.NodeTitle != "" {
+			title = h.NodeTitle
+		}
+
+		months[title] = append(months[title], h)
+	}
+
+	return months
+}
+
+// postParagraphs creates the paragraphs in the batch, in one request if the target supports it.
+// If the target rejects batches, supported is set to false and the paragraphs are created one at a time.
+func postParagraphs(ctx context.Context, batch []HoursByDayParagraph, cfg Config, supported *bool) error {
+	if *supported {
+		err := PostParagraphs(ctx, batch, cfg)
+		if !errors.Is(err, ErrBatchUnsupported) {
+			return err
+		}
+
+		cfg.progress().Printf(" (%v, creating paragraphs one at a time)", err)
+
+		*supported = false
+	}
+
+	if cfg.Concurrency > 1 {
+		return postConcurrently(ctx, batch, cfg)
+	}
+
+	for i := range batch {
+		err := batch[i].Post(ctx, cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// postConcurrently creates the paragraphs using up to cfg.Concurrency requests at a time, updating each in place.
+// The first error stops any paragraphs which haven't been started, and is returned once the others finish.
+func postConcurrently(ctx context.Context, batch []HoursByDayParagraph, cfg Config) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+
+	jobs := make(chan int)
+
+	for w := 0; w < cfg.Concurrency; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				err := batch[i].Post(ctx, cfg)
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+send:
+	for i := range batch {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break send
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return ctx.Err()
+}
+
+// confirm asks the operator a yes or no question with the Confirm function, returning true only if they answer yes.
+func (cfg Config) confirm(question string) bool {
+	if cfg.Confirm == nil {
+		return false
+	}
+
+	return cfg.Confirm(question)
+}
+
+// sleep pauses for the duration d, returning early with the context's error if it is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,567 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	_ "time/tzdata" // The tests use named time zones, which may not be installed.
+)
+
+func TestMarshalBodyIsByteStable(t *testing.T) {
+	h := DailyHours{
+		Day:           time.Date(2025, time.January, 6, 0, 0, 0, 0, time.UTC),
+		Note:          "Reading week",
+		BuildingHours: "8am - 11pm",
+		ChatHours:     "10am - 5pm",
+		Extra: map[string]string{
+			"field_study_room_hours": "9am - 9pm",
+			"field_cafe_hours":       "8am - 3pm",
+			"field_archives_hours":   "Closed",
+			"field_makerspace_hours": "noon - 4pm",
+		},
+	}
+
+	p := NewHoursByDayParagraph("node-uuid", h, DefaultFieldMap())
+
+	want := `{"data":{"type":"paragraph--hours_by_day","attributes":{` +
+		`"field_archives_hours":"Closed","field_building_hours":"8am - 11pm","field_cafe_hours":"8am - 3pm",` +
+		`"field_chat_hours":"10am - 5pm","field_day":"2025-01-06","field_holiday":false,` +
+		`"field_makerspace_hours":"noon - 4pm","field_note":"Reading week","field_study_room_hours":"9am - 9pm",` +
+		`"parent_field_name":"field_day","parent_id":"node-uuid","parent_type":"node"}}}`
+
+	first, err := marshalBody(p)
+	if err != nil {
+		t.Fatalf("marshalBody() failed, %v", err)
+	}
+
+	if string(first) != want {
+		t.Fatalf("marshalBody() = %s, want %s", first, want)
+	}
+
+	// Map iteration order is random, so marshal enough times that an unsorted map would show up.
+	for i := 0; i < 100; i++ {
+		b, err := marshalBody(p)
+		if err != nil {
+			t.Fatalf("marshalBody() failed, %v", err)
+		}
+
+		if !bytes.Equal(b, first) {
+			t.Fatalf("marshalBody() run %v = %s, want %s", i, b, first)
+		}
+	}
+}
+
+func TestGroupByTitle(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		format   string
+		grouping Grouping
+		days     []string
+		want     map[string][]string
+	}{
+		{
+			name:     "leap day",
+			location: "America/Toronto",
+			format:   "January, 2006",
+			grouping: GroupByMonth,
+			days:     []string{"2024-02-28", "2024-02-29", "2024-03-01"},
+			want: map[string][]string{
+				"February, 2024": {"2024-02-28", "2024-02-29"},
+				"March, 2024":    {"2024-03-01"},
+			},
+		},
+		{
+			name:     "month boundary",
+			location: "America/Toronto",
+			format:   "January, 2006",
+			grouping: GroupByMonth,
+			days:     []string{"2025-04-30", "2025-05-01"},
+			want: map[string][]string{
+				"April, 2025": {"2025-04-30"},
+				"May, 2025":   {"2025-05-01"},
+			},
+		},
+		{
+			name:     "year boundary",
+			location: "America/Toronto",
+			format:   "January, 2006",
+			grouping: GroupByMonth,
+			days:     []string{"2024-12-31", "2025-01-01"},
+			want: map[string][]string{
+				"December, 2024": {"2024-12-31"},
+				"January, 2025":  {"2025-01-01"},
+			},
+		},
+		{
+			name:     "year boundary far from UTC",
+			location: "Pacific/Kiritimati",
+			format:   "January, 2006",
+			grouping: GroupByMonth,
+			days:     []string{"2024-12-31", "2025-01-01"},
+			want: map[string][]string{
+				"December, 2024": {"2024-12-31"},
+				"January, 2025":  {"2025-01-01"},
+			},
+		},
+		{
+			name:     "template",
+			location: "America/Toronto",
+			format:   "Hours - {January 2006}",
+			grouping: GroupByMonth,
+			days:     []string{"2025-01-31", "2025-02-01"},
+			want: map[string][]string{
+				"Hours - January 2025":  {"2025-01-31"},
+				"Hours - February 2025": {"2025-02-01"},
+			},
+		},
+		{
+			name:     "weeks",
+			location: "America/Toronto",
+			format:   DefaultWeekTitleFormat,
+			grouping: GroupByWeek,
+			days:     []string{"2025-01-05", "2025-01-06", "2025-01-12", "2025-01-13"},
+			want: map[string][]string{
+				"Week of 2024-12-30": {"2025-01-05"},
+				"Week of 2025-01-06": {"2025-01-06", "2025-01-12"},
+				"Week of 2025-01-13": {"2025-01-13"},
+			},
+		},
+		{
+			name:     "week across a month boundary",
+			location: "America/Toronto",
+			format:   DefaultWeekTitleFormat,
+			grouping: GroupByWeek,
+			days:     []string{"2024-02-26", "2024-02-29", "2024-03-03", "2024-03-04"},
+			want: map[string][]string{
+				"Week of 2024-02-26": {"2024-02-26", "2024-02-29", "2024-03-03"},
+				"Week of 2024-03-04": {"2024-03-04"},
+			},
+		},
+		{
+			name:     "week across a change to daylight saving time",
+			location: "America/Toronto",
+			format:   DefaultWeekTitleFormat,
+			grouping: GroupByWeek,
+			days:     []string{"2025-03-09", "2025-03-10", "2025-03-16"},
+			want: map[string][]string{
+				"Week of 2025-03-03": {"2025-03-09"},
+				"Week of 2025-03-10": {"2025-03-10", "2025-03-16"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.location)
+			if err != nil {
+				t.Fatalf("loading location failed, %v", err)
+			}
+
+			hours := []DailyHours{}
+
+			for _, day := range tt.days {
+				d, err := parseDay("2006-01-02", day, loc)
+				if err != nil {
+					t.Fatalf("parseDay(%q) failed, %v", day, err)
+				}
+
+				hours = append(hours, DailyHours{Day: d})
+			}
+
+			got := map[string][]string{}
+
+			for title, days := range groupByTitle(hours, tt.format, tt.grouping) {
+				for _, h := range days {
+					got[title] = append(got[title], h.Day.Format("2006-01-02"))
+				}
+
+				sort.Strings(got[title])
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupByTitle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupByTitleUsesNodeTitle(t *testing.T) {
+	day := time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC)
+	hours := []DailyHours{{Day: day}, {Day: day.AddDate(0, 0, 1), NodeTitle: "Exam period"}}
+
+	got := groupByTitle(hours, "January, 2006", GroupByMonth)
+
+	if len(got) != 2 || len(got["January, 2025"]) != 1 || len(got["Exam period"]) != 1 {
+		t.Errorf("groupByTitle() = %v, want one day in 'January, 2025' and one in 'Exam period'", got)
+	}
+}
+
+// testServerConfig returns a configuration which sends requests to the test server.
+func testServerConfig(s *httptest.Server) Config {
+	return Config{
+		Target:             strings.TrimPrefix(s.URL, "http://"),
+		Scheme:             "http",
+		Username:           "admin",
+		Password:           "secret",
+		FieldMap:           DefaultFieldMap(),
+		ParagraphBatchSize: 1,
+		Client:             s.Client(),
+	}
+}
+
+func TestCreatedWithoutIDIsAnError(t *testing.T) {
+	// The server creates everything, but leaves the ID out of its response.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeHeader)
+		w.WriteHeader(http.StatusCreated)
+
+		if strings.HasPrefix(r.URL.Path, HoursByDayPath) {
+			_, _ = w.Write([]byte(`{"data":{"type":"paragraph--hours_by_day","attributes":{"drupal_internal__id":7}}}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"data":{"type":"node--hours","attributes":{"title":"January, 2025"}}}`))
+	}))
+	defer s.Close()
+
+	cfg := testServerConfig(s)
+	day := DailyHours{Day: time.Date(2025, time.January, 6, 12, 0, 0, 0, time.UTC), BuildingHours: "9-5", ChatHours: "10-4"}
+
+	t.Run("node", func(t *testing.T) {
+		n := NewHoursNode("January, 2025", cfg.FieldMap)
+
+		err := n.Post(context.Background(), cfg)
+		if !errors.Is(err, ErrMissingID) {
+			t.Errorf("Post() = %v, want %v", err, ErrMissingID)
+		}
+	})
+
+	t.Run("paragraph", func(t *testing.T) {
+		p := NewHoursByDayParagraph("node-uuid", day, cfg.FieldMap)
+
+		err := p.Post(context.Background(), cfg)
+		if !errors.Is(err, ErrMissingID) {
+			t.Errorf("Post() = %v, want %v", err, ErrMissingID)
+		}
+	})
+
+	t.Run("import", func(t *testing.T) {
+		cfg := cfg
+		cfg.AssumeYes = true
+		cfg.Progress = NewProgress(io.Discard)
+
+		// Finding existing nodes is the only read, and there aren't any.
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				_, _ = w.Write([]byte(`{"data":[]}`))
+				return
+			}
+
+			s.Config.Handler.ServeHTTP(w, r)
+		})
+
+		is := httptest.NewServer(mux)
+		defer is.Close()
+
+		cfg.Target = strings.TrimPrefix(is.URL, "http://")
+		cfg.Client = is.Client()
+
+		_, err := ImportHours(context.Background(), []DailyHours{day}, nil, cfg)
+		if !errors.Is(err, ErrMissingID) {
+			t.Errorf("ImportHours() = %v, want %v", err, ErrMissingID)
+		}
+	})
+}
+
+// fakeDrupal is a JSON:API server which creates whatever is posted to it, giving it an ID,
+// and finds no existing nodes. It records the method and path of each request.
+type fakeDrupal struct {
+	mu       sync.Mutex
+	created  int
+	requests []string
+}
+
+func (d *fakeDrupal) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.requests = append(d.requests, r.Method+" "+r.URL.Path)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeHeader)
+
+	switch r.Method {
+	case http.MethodGet:
+		_, _ = w.Write([]byte(`{"data":[]}`))
+	case http.MethodPost:
+		doc := struct {
+			Data map[string]interface{} `json:"data"`
+		}{}
+
+		if json.Unmarshal(body, &doc) != nil || doc.Data == nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+
+		d.created++
+		doc.Data["id"] = fmt.Sprintf("uuid-%v", d.created)
+
+		attributes, _ := doc.Data["attributes"].(map[string]interface{})
+		if attributes == nil {
+			attributes = map[string]interface{}{}
+		}
+
+		attributes["drupal_internal__id"] = d.created
+		attributes["drupal_internal__revision_id"] = d.created
+		doc.Data["attributes"] = attributes
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(doc)
+	case http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		_, _ = w.Write(body)
+	}
+}
+
+func TestImportHoursWithoutParagraphBatchSize(t *testing.T) {
+	d := &fakeDrupal{}
+
+	s := httptest.NewServer(d)
+	defer s.Close()
+
+	// A library caller may leave the batch size out.
+	cfg := Config{
+		Target:    strings.TrimPrefix(s.URL, "http://"),
+		Scheme:    "http",
+		Username:  "admin",
+		Password:  "secret",
+		FieldMap:  DefaultFieldMap(),
+		Client:    s.Client(),
+		AssumeYes: true,
+		Progress:  NewProgress(io.Discard),
+	}
+
+	hours := []DailyHours{
+		{Day: time.Date(2025, time.January, 6, 12, 0, 0, 0, time.UTC), BuildingHours: "9-5", ChatHours: "10-4"},
+		{Day: time.Date(2025, time.January, 7, 12, 0, 0, 0, time.UTC), BuildingHours: "9-5", ChatHours: "closed"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := ImportHours(ctx, hours, nil, cfg)
+	if err != nil {
+		t.Fatalf("ImportHours() failed, %v", err)
+	}
+
+	if result.Days() != len(hours) {
+		t.Errorf("ImportHours() imported %v days, want %v", result.Days(), len(hours))
+	}
+}
+
+// existingMonth is a JSON:API server with one node, which references paragraphs for
+// January 6th and 7th, 2025, and a paragraph of another type. Anything posted to it is created.
+// It records the method, path, and body of each request which writes to it.
+type existingMonth struct {
+	fakeDrupal
+	collection []byte
+	writes     []string
+}
+
+// newExistingMonth creates the server's node titled title.
+func newExistingMonth(t *testing.T, title string) *existingMonth {
+	fm := DefaultFieldMap()
+
+	n := NewHoursNode(title, fm)
+	n.Data.ID = "node-1"
+	n.Data.Relationships.Data = []ParagraphRelationship{
+		NewParagraphRelationship(fm.ParagraphType, "hours-6", 1),
+		NewParagraphRelationship("paragraph--banner", "banner-1", 2),
+		NewParagraphRelationship(fm.ParagraphType, "hours-7", 3),
+	}
+
+	collection, err := json.Marshal(struct {
+		Data []interface{} `json:"data"`
+	}{[]interface{}{n.Data}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &existingMonth{collection: collection}
+}
+
+func (m *existingMonth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fm := DefaultFieldMap()
+	days := map[string]string{"hours-6": "2025-01-06", "hours-7": "2025-01-07"}
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", ContentTypeHeader)
+
+		if day, ok := days[strings.TrimPrefix(r.URL.Path, fm.ParagraphPath+"/")]; ok {
+			fmt.Fprintf(w, `{"data":{"attributes":{%q:%q,%q:"Old note",%q:"9-5",%q:"10-4"}}}`,
+				fm.Fields.Day, day, fm.Fields.Note, fm.Fields.BuildingHours, fm.Fields.ChatHours)
+
+			return
+		}
+
+		_, _ = w.Write(m.collection)
+
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	m.writes = append(m.writes, r.Method+" "+r.URL.Path+" "+string(body))
+	m.mu.Unlock()
+
+	// A patched paragraph gets a new revision.
+	if r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, fm.ParagraphPath) {
+		w.Header().Set("Content-Type", ContentTypeHeader)
+		_, _ = w.Write([]byte(`{"data":{"type":"paragraph--hours_by_day","attributes":{"drupal_internal__revision_id":99}}}`))
+
+		return
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	m.fakeDrupal.ServeHTTP(w, r)
+}
+
+func TestUpdateFieldsPatchesExistingParagraphs(t *testing.T) {
+	const title = "January, 2025"
+
+	m := newExistingMonth(t, title)
+
+	s := httptest.NewServer(m)
+	defer s.Close()
+
+	cfg := testServerConfig(s)
+	cfg.AssumeYes = true
+	cfg.Update = true
+	cfg.UpdateFields = map[string]bool{"note": true}
+	cfg.Progress = NewProgress(io.Discard)
+
+	hours := []DailyHours{
+		{Day: time.Date(2025, time.January, 8, 12, 0, 0, 0, time.UTC), Note: "New day", BuildingHours: "9-5", ChatHours: "10-4"},
+		{Day: time.Date(2025, time.January, 6, 12, 0, 0, 0, time.UTC), Note: "New note", BuildingHours: "8-8", ChatHours: "closed"},
+	}
+
+	_, err := ImportHours(context.Background(), hours, nil, cfg)
+	if err != nil {
+		t.Fatalf("ImportHours() failed, %v", err)
+	}
+
+	fm := cfg.FieldMap
+	paragraphPatch, nodePatch := "", ""
+	deleted := []string{}
+
+	for _, w := range m.writes {
+		switch {
+		case strings.HasPrefix(w, "PATCH "+fm.ParagraphPath):
+			paragraphPatch = w
+		case strings.HasPrefix(w, "PATCH "+fm.NodePath):
+			nodePatch = w
+		case strings.HasPrefix(w, "DELETE "):
+			deleted = append(deleted, strings.TrimPrefix(w, "DELETE "))
+		}
+	}
+
+	// Only the selected field is sent to the day's existing paragraph.
+	if !strings.HasPrefix(paragraphPatch, "PATCH "+fm.ParagraphPath+"/hours-6 ") ||
+		!strings.Contains(paragraphPatch, `"New note"`) ||
+		strings.Contains(paragraphPatch, fm.Fields.BuildingHours) || strings.Contains(paragraphPatch, fm.Fields.ChatHours) {
+		t.Errorf("the paragraph was patched with %v, want only the note of hours-6", paragraphPatch)
+	}
+
+	// The node links the patched paragraph's new revision and the new paragraph, in order by day.
+	patched := strings.Index(nodePatch, `"id":"hours-6","meta":{"target_revision_id":99}`)
+	created := strings.Index(nodePatch, `"id":"uuid-1"`)
+
+	if patched < 0 || created < patched || strings.Contains(nodePatch, "hours-7") {
+		t.Errorf("the node was patched with %v, want hours-6 at revision 99, then uuid-1", nodePatch)
+	}
+
+	// The paragraph for a day which isn't in the CSV is replaced, and the other type is left alone.
+	if want := []string{fm.ParagraphPath + "/hours-7 "}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("ImportHours() deleted %q, want %q", deleted, want)
+	}
+}
+
+func TestPlanListsPatchedParagraphs(t *testing.T) {
+	const title = "January, 2025"
+
+	m := newExistingMonth(t, title)
+
+	s := httptest.NewServer(m)
+	defer s.Close()
+
+	cfg := testServerConfig(s)
+	cfg.Update = true
+	cfg.UpdateFields = map[string]bool{"note": true}
+
+	months := map[string][]DailyHours{title: {
+		{Day: time.Date(2025, time.January, 8, 12, 0, 0, 0, time.UTC), Note: "New day", BuildingHours: "9-5", ChatHours: "10-4"},
+		{Day: time.Date(2025, time.January, 6, 12, 0, 0, 0, time.UTC), Note: "New note", BuildingHours: "8-8", ChatHours: "closed"},
+	}}
+
+	path := filepath.Join(t.TempDir(), "plan.txt")
+
+	err := WritePlan(context.Background(), path, months, nil, cfg)
+	if err != nil {
+		t.Fatalf("WritePlan() failed, %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# Plan for importing hours into ` + cfg.Target + `.
+
+update node "January, 2025"
+  update paragraph 2025-01-06 (hours-6)
+    note: "New note"
+  create paragraph 2025-01-08
+    building hours: "9-5"
+    chat hours: "10-4"
+    note: "New day"
+  delete paragraph hours-7
+`
+	if string(got) != want {
+		t.Errorf("WritePlan() wrote\n%v\nwant\n%v", string(got), want)
+	}
+
+	if len(m.writes) > 0 {
+		t.Errorf("WritePlan() wrote to the target: %v", m.writes)
+	}
+}
@@ -0,0 +1,575 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// loadFromCSV processes one of the provided hours CSV files, or standard input if the argument is StdinArg.
+func loadFromCSV(arg string, cfg Config) (hours []DailyHours, err error) {
+	if arg == StdinArg {
+		return parseHours(os.Stdin, "standard input", cfg)
+	}
+
+	f, err := os.Open(arg)
+	if err != nil {
+		return hours, fmt.Errorf("processing CSV file '%v' failed, %w", arg, err)
+	}
+	defer f.Close()
+
+	return parseHours(f, arg, cfg)
+}
+
+// isURL reports whether the argument is an http or https URL rather than a file path.
+func isURL(arg string) bool {
+	return strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://")
+}
+
+// loadFromURL fetches one of the provided hours CSV files from a URL.
+func loadFromURL(ctx context.Context, url string, cfg Config) (hours []DailyHours, err error) {
+	// Create a new context from the base context with a timeout.
+	ctx, cancel := context.WithTimeout(ctx, cfg.requestTimeout())
+	defer cancel()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return hours, fmt.Errorf("processing CSV file '%v' failed, %w", url, err)
+	}
+
+	if cfg.InputAuth != "" {
+		parts := strings.SplitN(cfg.InputAuth, ":", 2)
+		if len(parts) != 2 {
+			return hours, fmt.Errorf("processing CSV file '%v' failed, %w: input auth must be in the form username:password",
+				url, ErrInputFetch)
+		}
+
+		r.SetBasicAuth(parts[0], parts[1])
+	}
+
+	resp, err := cfg.HTTPClient().Do(r)
+	if err != nil {
+		return hours, fmt.Errorf("processing CSV file '%v' failed, %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return hours, fmt.Errorf("processing CSV file '%v' failed, %w: GET returned [%v]", url, ErrInputFetch, resp.StatusCode)
+	}
+
+	return parseHours(resp.Body, url, cfg)
+}
+
+// parseHours parses the hours from a CSV-formatted reader.
+// The name identifies the source of the reader in error messages.
+func parseHours(f io.Reader, name string, cfg Config) (hours []DailyHours, err error) {
+	f, err = decompressInput(f)
+	if err != nil {
+		return hours, fmt.Errorf("processing CSV file '%v' failed, %w", name, err)
+	}
+
+	f, err = decodeInput(f, cfg.InputEncoding)
+	if err != nil {
+		return hours, fmt.Errorf("processing CSV file '%v' failed, %w", name, err)
+	}
+
+	hours, err = parseCSV(cfg.csvReader(f), name, cfg)
+	if err != nil {
+		return hours, fmt.Errorf("processing CSV file '%v' failed, %w", name, err)
+	}
+
+	return hours, nil
+}
+
+// csvReader returns a CSV reader for f which uses the configured delimiter and comment character.
+func (cfg Config) csvReader(f io.Reader) *csv.Reader {
+	r := csv.NewReader(f)
+
+	if cfg.Delimiter != 0 {
+		r.Comma = cfg.Delimiter
+	}
+
+	r.Comment = cfg.Comment
+
+	return r
+}
+
+// ParseDelimiter converts a delimiter flag like ";" into the rune which separates CSV fields.
+// The two characters \t are accepted for a tab, which is awkward to type.
+func ParseDelimiter(s string) (rune, error) {
+	if s == `\t` {
+		return '\t', nil
+	}
+
+	r, ok := csvRune(s)
+	if !ok {
+		return 0, fmt.Errorf("%w: '%v', expected a single character other than a quote or line break", ErrInvalidDelimiter, s)
+	}
+
+	return r, nil
+}
+
+// ParseComment converts a comment flag like "#" into the rune which starts comment lines.
+// An empty flag returns zero, which disables comments.
+func ParseComment(s string, delimiter rune) (rune, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	r, ok := csvRune(s)
+	if !ok {
+		return 0, fmt.Errorf("%w: '%v', expected a single character other than a quote or line break", ErrInvalidComment, s)
+	}
+
+	if r == delimiter || (delimiter == 0 && r == ',') {
+		return 0, fmt.Errorf("%w: '%v' is also the delimiter", ErrInvalidComment, s)
+	}
+
+	return r, nil
+}
+
+// csvRune returns the single character in s, and whether the csv package can use it as a delimiter or comment.
+func csvRune(s string) (rune, bool) {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 || size != len(s) || r == utf8.RuneError {
+		return 0, false
+	}
+
+	return r, r != '"' && r != '\r' && r != '\n'
+}
+
+// gzipMagic are the first bytes of a gzip stream.
+const gzipMagic = "\x1f\x8b"
+
+// decompressInput returns a reader which decompresses f if it is gzip compressed, like a .csv.gz file,
+// and returns the contents of f unchanged otherwise. Compression is detected from the first bytes,
+// so it works for files, standard input, and URLs alike.
+func decompressInput(f io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(f)
+
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if string(magic) != gzipMagic {
+		return br, nil
+	}
+
+	return gzip.NewReader(br)
+}
+
+// readError adds the line the record started on to an error from reading a CSV record.
+// A record with the wrong number of fields is reported with how many fields it has and how many were expected.
+func readError(err error, l []string, expected int) error {
+	pe := &csv.ParseError{}
+	if !errors.As(err, &pe) {
+		return err
+	}
+
+	switch {
+	case errors.Is(pe.Err, csv.ErrFieldCount) && len(l) < expected:
+		return fmt.Errorf("%w: record on line %v has %v fields, expected %v", ErrMissingData, pe.StartLine, len(l), expected)
+	case errors.Is(pe.Err, csv.ErrFieldCount):
+		return fmt.Errorf("%w: record on line %v has %v fields, expected %v", ErrInvalidData, pe.StartLine, len(l), expected)
+	}
+
+	return fmt.Errorf("%w: record on line %v, column %v: %v", ErrInvalidData, pe.StartLine, pe.Column, pe.Err)
+}
+
+// parseCSV reads the header and data lines from the CSV reader, using the columns named in the field map.
+func parseCSV(r *csv.Reader, name string, cfg Config) (hours []DailyHours, err error) {
+	fm := cfg.FieldMap
+
+	// A map of column names to indexes.
+	h := map[string]int{}
+
+	// If the first line doesn't exist, return the header error.
+	l, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return hours, ErrNoHeader
+	}
+
+	if err != nil {
+		return hours, readError(err, l, 0)
+	}
+
+	header := l
+
+	// Every data line must have a field for each column in the header.
+	r.FieldsPerRecord = len(header)
+
+	// Build the column name map from the header line.
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+
+		// Unnamed columns can't be looked up, and would collide with each other in the map.
+		if name == "" {
+			if cfg.IgnoreUnnamedColumns {
+				continue
+			}
+
+			return hours, fmt.Errorf("%w: column %v has no name", ErrInvalidHeader, i+1)
+		}
+
+		h[name] = i
+	}
+
+	// The mapped columns must all be in the header, or the wrong column would be read.
+	// Composed building hours are read from the open and close columns instead of the building hours column.
+	required := []string{fm.Columns.Day, fm.Columns.Note, fm.Columns.BuildingHours, fm.Columns.ChatHours}
+	if cfg.ComposeHours != "" {
+		required = []string{fm.Columns.Day, fm.Columns.Note, fm.Columns.Open, fm.Columns.Close, fm.Columns.ChatHours}
+	}
+
+	for _, column := range required {
+		if _, ok := h[column]; !ok {
+			return hours, fmt.Errorf("%w: expected column '%v' not found", ErrInvalidHeader, column)
+		}
+	}
+
+	for field, column := range fm.ExtraFields {
+		if _, ok := h[column]; !ok {
+			return hours, fmt.Errorf("%w: column '%v' for extra field '%v' not found", ErrInvalidHeader, column, field)
+		}
+	}
+
+	// Read all the data lines, so the date layout can be detected from a sample of them.
+	lines := [][]string{}
+
+	// The line each data line starts on, since comments and quoted line breaks don't take up a data line.
+	lineNums := []int{}
+
+	for {
+		l, err := r.Read()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return hours, readError(err, l, len(header))
+		}
+
+		lineNum, _ := r.FieldPos(0)
+
+		lines = append(lines, l)
+		lineNums = append(lineNums, lineNum)
+	}
+
+	// A file with only a header usually means the export went wrong.
+	if len(lines) == 0 {
+		if cfg.Strict {
+			return hours, fmt.Errorf("%w: the file has a header but no data lines", ErrNoData)
+		}
+
+		cfg.progress().Printf("Warning: '%v' contained a header but no data rows.\n", name)
+		cfg.LogEvent(slog.LevelWarn, "no data rows", "file", name)
+	}
+
+	layout := cfg.dateLayout()
+
+	if cfg.DetectDateLayout {
+		sample := []string{}
+
+		for _, l := range lines {
+			if len(sample) == DateLayoutSampleSize {
+				break
+			}
+
+			if day := strings.TrimSpace(l[h[fm.Columns.Day]]); day != "" {
+				sample = append(sample, day)
+			}
+		}
+
+		layout, err = detectDateLayout(sample, cfg.DateLayouts)
+		if err != nil {
+			return hours, err
+		}
+
+		logVerbose(cfg, "Detected date layout '%v' in '%v'.\n", layout, name)
+	}
+
+	for i, l := range lines {
+		// Keep track of the line number for error reporting.
+		lineNum := lineNums[i]
+
+		// Pull the data from the line using the header map, trimming leading and trailing space.
+		note := strings.TrimSpace(l[h[fm.Columns.Note]])
+		chatHours := strings.TrimSpace(l[h[fm.Columns.ChatHours]])
+
+		var buildingHours string
+		if cfg.ComposeHours != "" {
+			buildingHours = composeHours(cfg.ComposeHours,
+				strings.TrimSpace(l[h[fm.Columns.Open]]), strings.TrimSpace(l[h[fm.Columns.Close]]))
+		} else {
+			buildingHours = strings.TrimSpace(l[h[fm.Columns.BuildingHours]])
+		}
+
+		// The node title column is optional.
+		nodeTitle := ""
+		if i, ok := h[fm.Columns.NodeTitle]; ok {
+			nodeTitle = strings.TrimSpace(l[i])
+		}
+
+		// The reference column is optional, and only read if a reference field is configured.
+		reference := ""
+		if i, ok := h[fm.Columns.Reference]; ok && fm.ReferenceField != "" {
+			reference = strings.ToLower(strings.TrimSpace(l[i]))
+			if reference != "" && !uuidPattern.MatchString(reference) {
+				return hours, fmt.Errorf("%w: reference '%v' on line %v is not a UUID", ErrInvalidData, reference, lineNum)
+			}
+		}
+
+		// The holiday column is optional, and days are not holidays without it.
+		holiday := false
+		if i, ok := h[fm.Columns.Holiday]; ok {
+			var ok bool
+
+			holiday, ok = parseHoliday(l[i])
+			if !ok {
+				return hours, fmt.Errorf("%w: holiday '%v' on line %v is not true or false",
+					ErrInvalidData, strings.TrimSpace(l[i]), lineNum)
+			}
+		}
+
+		// Extra fields are read from the columns named in the field map.
+		var extra map[string]string
+
+		for field, column := range fm.ExtraFields {
+			if extra == nil {
+				extra = map[string]string{}
+			}
+
+			extra[field] = strings.TrimSpace(l[h[column]])
+		}
+
+		day := strings.TrimSpace(l[h[fm.Columns.Day]])
+		if day == "" {
+			return hours, fmt.Errorf("%w: empty day on line %v", ErrMissingData, lineNum)
+		}
+
+		// Parse the day into a Time so we can more easily process it later.
+		// The reference time is documented here: https://golang.org/pkg/time/#Parse
+		parsedDay, err := parseDay(layout, day, cfg.location())
+		if err != nil {
+			if cfg.DetectDateLayout {
+				return hours, fmt.Errorf("%w: day '%v' on line %v does not match the detected layout '%v'",
+					ErrInvalidData, day, lineNum, layout)
+			}
+
+			return hours, fmt.Errorf("%w: day '%v' on line %v does not match the layout '%v'",
+				ErrInvalidData, day, lineNum, layout)
+		}
+
+		if buildingHours == "" {
+			return hours, fmt.Errorf("%w: empty building hours on line %v", ErrMissingData, lineNum)
+		}
+
+		if chatHours == "" {
+			return hours, fmt.Errorf("%w: empty chat hours on line %v", ErrMissingData, lineNum)
+		}
+
+		if cfg.StrictHours {
+			if !hoursPattern.MatchString(buildingHours) {
+				return hours, fmt.Errorf("%w: building hours '%v' on line %v are not in a recognized format",
+					ErrInvalidData, buildingHours, lineNum)
+			}
+
+			if !hoursPattern.MatchString(chatHours) {
+				return hours, fmt.Errorf("%w: chat hours '%v' on line %v are not in a recognized format",
+					ErrInvalidData, chatHours, lineNum)
+			}
+		}
+
+		// Building hours can also be posted as structured open and close times.
+		open, closing := "", ""
+
+		if cfg.StructuredHoursLayout != "" {
+			open, closing, err = parseOpenClose(buildingHours, cfg.StructuredHoursLayout)
+			if err != nil {
+				return hours, fmt.Errorf("%w: building hours '%v' on line %v: %v", ErrInvalidData, buildingHours, lineNum, err)
+			}
+		}
+
+		n := DailyHours{
+			Day:           parsedDay,
+			Note:          note,
+			BuildingHours: buildingHours,
+			BuildingOpen:  open,
+			BuildingClose: closing,
+			ChatHours:     chatHours,
+			Holiday:       holiday,
+			NodeTitle:     nodeTitle,
+			Reference:     reference,
+			Extra:         extra,
+		}
+
+		hours = append(hours, n)
+	}
+
+	return hours, nil
+}
+
+// dateLayout returns the configured layout of the day column, or DefaultDateLayout if none was configured.
+func (cfg Config) dateLayout() string {
+	if cfg.DateLayout == "" {
+		return DefaultDateLayout
+	}
+
+	return cfg.DateLayout
+}
+
+// location returns the configured time zone of the days, or the local time zone if none was configured.
+func (cfg Config) location() *time.Location {
+	if cfg.Location == nil {
+		return time.Local
+	}
+
+	return cfg.Location
+}
+
+// parseHoliday reads a holiday cell, which is true, false, yes, no, 1, or 0 in any case.
+// An empty cell is not a holiday. It returns false for ok if the cell is anything else.
+func parseHoliday(value string) (holiday, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "yes", "1":
+		return true, true
+	case "false", "no", "0", "":
+		return false, true
+	}
+
+	return false, false
+}
+
+// composeHours builds building hours from separate open and close times, using a template like
+// "{open} - {close}". A day without an open or close time, or which opens and closes at the same time, is closed.
+func composeHours(template, open, closing string) string {
+	if open == "" || closing == "" || strings.EqualFold(open, closing) {
+		return "Closed"
+	}
+
+	return strings.NewReplacer("{open}", open, "{close}", closing).Replace(template)
+}
+
+// parseOpenClose parses building hours like "9:00am - 5:00pm" into open and close times in the form 15:04:05,
+// using the layout for each time. Hours of "closed" have no open or close time.
+func parseOpenClose(value, layout string) (open, closing string, err error) {
+	if strings.EqualFold(value, "closed") {
+		return "", "", nil
+	}
+
+	// Accept an en dash as well as a hyphen between the times.
+	parts := strings.Split(strings.ReplaceAll(value, "–", "-"), "-")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("expected an open and close time separated by '-'")
+	}
+
+	times := []string{}
+
+	for _, part := range parts {
+		t, err := time.Parse(layout, strings.TrimSpace(part))
+		if err != nil {
+			return "", "", fmt.Errorf("the time '%v' does not match the layout '%v'", strings.TrimSpace(part), layout)
+		}
+
+		times = append(times, t.Format("15:04:05"))
+	}
+
+	return times[0], times[1], nil
+}
+
+// detectDateLayout returns the first of the candidate layouts which parses every day in the sample.
+func detectDateLayout(sample, candidates []string) (string, error) {
+	for _, layout := range candidates {
+		matches := true
+
+		for _, day := range sample {
+			if _, err := time.Parse(layout, day); err != nil {
+				matches = false
+
+				break
+			}
+		}
+
+		if matches {
+			return layout, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: no date layout out of '%v' matches the days %v",
+		ErrInvalidData, strings.Join(candidates, "', '"), strings.Join(sample, ", "))
+}
+
+// parseDay parses a date using layout, returning noon on that date in loc.
+// Using noon rather than midnight means a daylight saving time transition can
+// never move the day onto the previous or next date, or into another month.
+// The date is read in UTC, since in zones which change their clocks at midnight
+// the start of the day may not exist in loc, and would be moved to the day before.
+func parseDay(layout, value string, loc *time.Location) (time.Time, error) {
+	t, err := time.ParseInLocation(layout, value, time.UTC)
+	if err != nil {
+		return t, err
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, loc), nil
+}
+
+// dedupeDays checks the days for dates which appear more than once, like overlapping exports.
+// Days with their own node title are only compared with other days for the same node.
+// A duplicate is an error listing the duplicated dates, unless lastWins is set, in which case only the last
+// occurrence of each date is kept.
+func dedupeDays(hours []DailyHours, lastWins bool) ([]DailyHours, error) {
+	key := func(h DailyHours) string {
+		return h.NodeTitle + "\n" + h.Day.Format("2006-01-02")
+	}
+
+	count := map[string]int{}
+	duplicates := []string{}
+
+	for _, h := range hours {
+		k := key(h)
+		count[k]++
+
+		if count[k] == 2 {
+			duplicates = append(duplicates, h.Day.Format("2006-01-02"))
+		}
+	}
+
+	if len(duplicates) == 0 {
+		return hours, nil
+	}
+
+	if !lastWins {
+		return hours, fmt.Errorf("%w: %v appear more than once, set -last-wins to keep the last of each",
+			ErrDuplicateDay, strings.Join(duplicates, ", "))
+	}
+
+	deduped := []DailyHours{}
+
+	for _, h := range hours {
+		k := key(h)
+		count[k]--
+
+		if count[k] == 0 {
+			deduped = append(deduped, h)
+		}
+	}
+
+	return deduped, nil
+}
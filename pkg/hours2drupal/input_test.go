@@ -0,0 +1,111 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+	_ "time/tzdata" // The tests use named time zones, which may not be installed.
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestParseDayAroundDSTChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		day      string
+		month    string
+	}{
+		{name: "day before spring forward", location: "America/Toronto", day: "2025-03-08", month: "March, 2025"},
+		{name: "spring forward", location: "America/Toronto", day: "2025-03-09", month: "March, 2025"},
+		{name: "day after spring forward", location: "America/Toronto", day: "2025-03-10", month: "March, 2025"},
+		{name: "day before fall back", location: "America/Toronto", day: "2025-11-01", month: "November, 2025"},
+		{name: "fall back", location: "America/Toronto", day: "2025-11-02", month: "November, 2025"},
+		{name: "day after fall back", location: "America/Toronto", day: "2025-11-03", month: "November, 2025"},
+		// Chile has changed its clocks at midnight, so midnight doesn't exist on the day of the change.
+		{name: "spring forward at midnight", location: "America/Santiago", day: "2024-09-08", month: "September, 2024"},
+		{name: "fall back at midnight", location: "America/Santiago", day: "2025-04-06", month: "April, 2025"},
+		// The first day of a month which starts on a change must not fall back into the previous month.
+		{name: "month starting on a change", location: "America/Havana", day: "2012-04-01", month: "April, 2012"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.location)
+			if err != nil {
+				t.Fatalf("loading location failed, %v", err)
+			}
+
+			d, err := parseDay("2006-01-02", tt.day, loc)
+			if err != nil {
+				t.Fatalf("parseDay(%q) failed, %v", tt.day, err)
+			}
+
+			if got := d.Format("2006-01-02"); got != tt.day {
+				t.Errorf("parseDay(%q) = %v, want the same date", tt.day, got)
+			}
+
+			if d.Hour() != 12 {
+				t.Errorf("parseDay(%q) = %v, want local noon", tt.day, d)
+			}
+
+			// Converting to UTC, as a server might, must not move the date either.
+			if got := d.UTC().Format("2006-01-02"); got != tt.day {
+				t.Errorf("parseDay(%q) in UTC = %v, want the same date", tt.day, got)
+			}
+
+			if got := d.Format("January, 2006"); got != tt.month {
+				t.Errorf("parseDay(%q) is in %v, want %v", tt.day, got, tt.month)
+			}
+
+			// The plain date is posted to Drupal, without a time.
+			p := NewHoursByDayParagraph("node-uuid", DailyHours{Day: d}, DefaultFieldMap())
+			if p.Data.Attributes.Day != tt.day {
+				t.Errorf("posted day = %v, want %v", p.Data.Attributes.Day, tt.day)
+			}
+		})
+	}
+}
+
+func TestDecodeInputRemovesByteOrderMark(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding encoding.Encoding
+		input    []byte
+	}{
+		{name: "validated UTF-8", input: []byte(utf8BOM + "day,note\n")},
+		{name: "transcoded UTF-8", encoding: unicode.UTF8, input: []byte(utf8BOM + "day,note\n")},
+		{
+			name:     "UTF-16",
+			encoding: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+			input:    []byte("\xff\xfed\x00a\x00y\x00,\x00n\x00o\x00t\x00e\x00\n\x00"),
+		},
+		{name: "Windows-1252", encoding: charmap.Windows1252, input: []byte("day,note\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := decodeInput(bytes.NewReader(tt.input), tt.encoding)
+			if err != nil {
+				t.Fatalf("decodeInput() failed, %v", err)
+			}
+
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != "day,note\n" {
+				t.Errorf("decodeInput() = %q, want %q", got, "day,note\n")
+			}
+		})
+	}
+}
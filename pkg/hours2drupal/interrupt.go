@@ -0,0 +1,55 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"fmt"
+)
+
+// monthStep records how far the import of a month has got, so an interrupted import can report
+// the state it left the target in.
+type monthStep struct {
+	Title string
+	// Step describes what was being done, like "creating paragraphs".
+	Step string
+	// Day is the first day of the batch of paragraphs being created, if paragraphs are being created.
+	Day string
+	// NodeID is the ID of the month's node, once it exists on the target.
+	NodeID string
+	// Created is the number of new paragraphs which were created.
+	Created int
+	// Linked is the number of new paragraphs the node was last patched to link.
+	Linked int
+}
+
+// interrupted describes where the month's import stopped, and whether the node links its new paragraphs.
+// The request which was in flight may still have completed on the target, so the description says so.
+func (s monthStep) interrupted() string {
+	where := fmt.Sprintf("%v of '%v'", s.Step, s.Title)
+	if s.Day != "" {
+		where = fmt.Sprintf("%v for %v of '%v'", s.Step, s.Day, s.Title)
+	}
+
+	state := ""
+
+	switch {
+	case s.NodeID == "" && s.Created == 0:
+		state = "nothing had been created for the month"
+	case s.NodeID == "":
+		state = fmt.Sprintf("%v paragraphs had been created, but not the node which links them", s.Created)
+	case s.Created == 0:
+		state = fmt.Sprintf("node %v had no new paragraphs", s.NodeID)
+	case s.Linked == s.Created:
+		state = fmt.Sprintf("node %v had been patched to link all %v new paragraphs", s.NodeID, s.Created)
+	case s.Linked == 0:
+		state = fmt.Sprintf("%v paragraphs had been created, but node %v hadn't been patched to link them", s.Created, s.NodeID)
+	default:
+		state = fmt.Sprintf("%v paragraphs had been created, but node %v had only been patched to link %v of them",
+			s.Created, s.NodeID, s.Linked)
+	}
+
+	return fmt.Sprintf("interrupted while %v: %v, and the request in flight may have completed", where, state)
+}
@@ -0,0 +1,45 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// ErrUnknownLogFormat is an error which is returned when a log format isn't text or json.
+var ErrUnknownLogFormat = errors.New("unknown log format")
+
+// LogFormatText and LogFormatJSON are the supported values of -log-format.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// NewLogger creates the structured logger for the log format, writing to w.
+// The text format keeps the plain progress output and returns nil.
+func NewLogger(format string, w io.Writer) (*slog.Logger, error) {
+	switch format {
+	case LogFormatText:
+		return nil, nil
+	case LogFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, nil)), nil
+	default:
+		return nil, fmt.Errorf("%w '%v', expected %v or %v", ErrUnknownLogFormat, format, LogFormatText, LogFormatJSON)
+	}
+}
+
+// LogEvent writes a structured log line for a step of the import, if structured logging is enabled.
+func (cfg Config) LogEvent(level slog.Level, msg string, args ...any) {
+	if cfg.Logger == nil {
+		return
+	}
+
+	cfg.Logger.Log(context.Background(), level, msg, args...)
+}
@@ -0,0 +1,128 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// ErrNodeNotFound is an error which is returned when an existing node can't be found for a month.
+var ErrNodeNotFound = errors.New("no existing node found")
+
+// ErrAmbiguousNode is an error which is returned when more than one existing node has a month's title.
+var ErrAmbiguousNode = errors.New("more than one existing node found")
+
+// Get uses the JSON API endpoint at target to load the node with the struct's ID.
+func (n *HoursNode) Get(ctx context.Context, cfg Config) error {
+	url := fmt.Sprintf("%v%v/%v", cfg.BaseURL(), cfg.FieldMap.NodePath, n.Data.ID)
+	return n.doAPICall(ctx, cfg, url, http.MethodGet)
+}
+
+// FindHoursNodes uses the JSON API endpoint at target to find the nodes with the title.
+func FindHoursNodes(ctx context.Context, cfg Config, title string) ([]HoursNode, error) {
+	q := url.Values{}
+	q.Set("filter[title]", title)
+
+	u := fmt.Sprintf("%v%v?%v", cfg.BaseURL(), cfg.FieldMap.NodePath, q.Encode())
+
+	collection := struct {
+		Data []json.RawMessage `json:"data"`
+	}{}
+
+	_, err := callAPI(ctx, cfg, u, http.MethodGet, &collection, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []HoursNode{}
+
+	for _, raw := range collection.Data {
+		n := NewHoursNode(title, cfg.FieldMap)
+
+		err := json.Unmarshal(raw, &n.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, n)
+	}
+
+	return nodes, nil
+}
+
+// Lookup finds the existing node with the node's title, setting the node's ID and relationships from the server.
+// It returns false if there is no such node, and ErrAmbiguousNode if there is more than one.
+func (n *HoursNode) Lookup(ctx context.Context, cfg Config) (bool, error) {
+	title := n.Data.Attributes.Title
+
+	nodes, err := FindHoursNodes(ctx, cfg, title)
+	if err != nil {
+		return false, err
+	}
+
+	switch len(nodes) {
+	case 0:
+		return false, nil
+	case 1:
+		*n = nodes[0]
+		return true, nil
+	default:
+		return false, fmt.Errorf("%w: %v nodes are titled '%v'", ErrAmbiguousNode, len(nodes), title)
+	}
+}
+
+// existingNode finds the existing node for the title, using the node ID mapping if there is one
+// and otherwise looking the node up by its title.
+func existingNode(ctx context.Context, cfg Config, title string) (HoursNode, error) {
+	if cfg.NodeIDs != nil {
+		id, ok := cfg.NodeIDs[title]
+		if !ok {
+			return HoursNode{}, fmt.Errorf("%w: '%v' is not in the node ID mapping", ErrNodeNotFound, title)
+		}
+
+		n := NewHoursNode(title, cfg.FieldMap)
+		n.Data.ID = id
+
+		return n, n.Get(ctx, cfg)
+	}
+
+	nodes, err := FindHoursNodes(ctx, cfg, title)
+	if err != nil {
+		return HoursNode{}, err
+	}
+
+	switch len(nodes) {
+	case 0:
+		return HoursNode{}, fmt.Errorf("%w: no node is titled '%v'", ErrNodeNotFound, title)
+	case 1:
+		return nodes[0], nil
+	default:
+		return HoursNode{}, fmt.Errorf("%w: %v nodes are titled '%v'", ErrAmbiguousNode, len(nodes), title)
+	}
+}
+
+// LoadNodeIDs reads a JSON object mapping node titles to existing node IDs from path.
+func LoadNodeIDs(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[string]string{}
+
+	err = json.Unmarshal(b, &ids)
+	if err != nil {
+		return nil, fmt.Errorf("reading node IDs from '%v' failed, %w", path, err)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// ErrManifestTarget is an error which is returned when a manifest was written for a different target.
+var ErrManifestTarget = errors.New("the manifest is for a different target")
+
+// Manifest records the days a failed import didn't finish, so they can be re-imported by a later run.
+type Manifest struct {
+	// Target is the server the failed import was sending hours to.
+	Target string `json:"target"`
+	// Days are the days which weren't imported.
+	Days []ManifestDay `json:"days"`
+}
+
+// ManifestDay is one day which wasn't imported.
+type ManifestDay struct {
+	// Day is the date, in the form 2006-01-02.
+	Day           string `json:"day"`
+	Note          string `json:"note"`
+	BuildingHours string `json:"building_hours"`
+	BuildingOpen  string `json:"building_open,omitempty"`
+	BuildingClose string `json:"building_close,omitempty"`
+	ChatHours     string `json:"chat_hours"`
+	Reference     string `json:"reference,omitempty"`
+	Holiday       bool   `json:"holiday,omitempty"`
+	// Extra holds the values of additional paragraph fields, keyed by machine name.
+	Extra map[string]string `json:"extra,omitempty"`
+	// NodeTitle is the title of the node the day belongs to.
+	NodeTitle string `json:"node_title"`
+	// NodeID is the ID of the node, if the failed import had already created or found it.
+	// The day is attached to that node when it is re-imported, instead of to a new node.
+	NodeID string `json:"node_id,omitempty"`
+}
+
+// NewManifest builds the manifest of the days which aren't in the result of an import.
+// The titles map the keys of months to the titles their nodes were given, for the months the import reached.
+func NewManifest(target string, months map[string][]DailyHours, titles map[string]string, result Result) Manifest {
+	m := Manifest{Target: target, Days: []ManifestDay{}}
+
+	nodeIDs := map[string]string{}
+	imported := map[string]bool{}
+
+	for _, n := range result.Nodes {
+		nodeIDs[n.Title] = n.ID
+
+		// Days whose paragraphs were created but never linked to the node still need to be imported.
+		for _, p := range n.Paragraphs {
+			if p.Linked {
+				imported[n.Title+"\n"+p.Day] = true
+			}
+		}
+	}
+
+	for month, days := range months {
+		title, ok := titles[month]
+		if !ok {
+			title = month
+		}
+
+		for _, h := range days {
+			day := h.Day.Format("2006-01-02")
+			if imported[title+"\n"+day] {
+				continue
+			}
+
+			m.Days = append(m.Days, ManifestDay{
+				Day:           day,
+				Note:          h.Note,
+				BuildingHours: h.BuildingHours,
+				BuildingOpen:  h.BuildingOpen,
+				BuildingClose: h.BuildingClose,
+				ChatHours:     h.ChatHours,
+				Reference:     h.Reference,
+				Holiday:       h.Holiday,
+				Extra:         h.Extra,
+				NodeTitle:     title,
+				NodeID:        nodeIDs[title],
+			})
+		}
+	}
+
+	sort.SliceStable(m.Days, func(i, j int) bool {
+		if m.Days[i].Day == m.Days[j].Day {
+			return m.Days[i].NodeTitle < m.Days[j].NodeTitle
+		}
+
+		return m.Days[i].Day < m.Days[j].Day
+	})
+
+	return m
+}
+
+// WriteManifest writes the manifest to a JSON file at path.
+func WriteManifest(path string, m Manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// LoadManifest reads a manifest written by a failed import for the target from path, parsing the days in loc.
+// It returns the days to import, and a map of node titles to the IDs of the nodes which already exist.
+func LoadManifest(path, target string, loc *time.Location) ([]DailyHours, map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m := Manifest{}
+
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading manifest '%v' failed, %w", path, err)
+	}
+
+	if m.Target != target {
+		return nil, nil, fmt.Errorf("reading manifest '%v' failed, %w: it was written for '%v'", path, ErrManifestTarget, m.Target)
+	}
+
+	hours := []DailyHours{}
+	nodeIDs := map[string]string{}
+
+	for i, d := range m.Days {
+		day, err := parseDay("2006-01-02", d.Day, loc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading manifest '%v' failed, %w: day %v: %v", path, ErrInvalidData, i+1, err)
+		}
+
+		hours = append(hours, DailyHours{
+			Day:           day,
+			Note:          d.Note,
+			BuildingHours: d.BuildingHours,
+			BuildingOpen:  d.BuildingOpen,
+			BuildingClose: d.BuildingClose,
+			ChatHours:     d.ChatHours,
+			NodeTitle:     d.NodeTitle,
+			Reference:     d.Reference,
+			Holiday:       d.Holiday,
+			Extra:         d.Extra,
+		})
+
+		if d.NodeID != "" {
+			nodeIDs[d.NodeTitle] = d.NodeID
+		}
+	}
+
+	return hours, nodeIDs, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RunMetrics are the counters describing a run which are pushed to a Prometheus Pushgateway.
+type RunMetrics struct {
+	Target       string
+	Result       string
+	DaysImported int
+	Errors       int
+	Duration     time.Duration
+}
+
+// Push sends the metrics to the Pushgateway at gateway with client, replacing any metrics
+// previously pushed for the same job and target. The client shouldn't be the one used for the target,
+// since the target's CA certificates and TLS settings don't apply to the Pushgateway.
+// If client is nil, the default client is used. A timeout of zero uses RequestTimeout.
+func (m RunMetrics) Push(ctx context.Context, client *http.Client, timeout time.Duration, gateway string) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if timeout <= 0 {
+		timeout = RequestTimeout
+	}
+
+	// Create a new context from the base context with a timeout.
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	u := fmt.Sprintf("%v/metrics/job/%v/target/%v",
+		strings.TrimSuffix(gateway, "/"), ProjectName, url.PathEscape(m.Target))
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(m.encode()))
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The Pushgateway responds with 200 or 202 when the metrics are accepted.
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusAccepted {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: %v %v failed [%v]\n%v", ErrAPIError, r.Method, r.URL.String(), resp.StatusCode, string(body))
+}
+
+// encode renders the metrics in the Prometheus text exposition format.
+func (m RunMetrics) encode() []byte {
+	b := &bytes.Buffer{}
+	labels := fmt.Sprintf("{result=%q}", m.Result)
+
+	fmt.Fprintf(b, "# TYPE %v_days_imported_total counter\n", ProjectName)
+	fmt.Fprintf(b, "%v_days_imported_total%v %v\n", ProjectName, labels, m.DaysImported)
+	fmt.Fprintf(b, "# TYPE %v_errors_total counter\n", ProjectName)
+	fmt.Fprintf(b, "%v_errors_total%v %v\n", ProjectName, labels, m.Errors)
+	fmt.Fprintf(b, "# TYPE %v_duration_seconds gauge\n", ProjectName)
+	fmt.Fprintf(b, "%v_duration_seconds%v %v\n", ProjectName, labels, m.Duration.Seconds())
+
+	return b.Bytes()
+}
@@ -0,0 +1,39 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidAttemptOrder is an error which is returned when an unknown attempt order is requested.
+var ErrInvalidAttemptOrder = errors.New("invalid attempt order")
+
+// AttemptOrder is a strategy for sequencing the requests which create a month's node and paragraphs.
+type AttemptOrder string
+
+const (
+	// AttemptOrderIncremental creates the node, then patches the node's relationships after each batch of paragraphs.
+	// A failure part way through leaves the node linked to every paragraph created so far.
+	AttemptOrderIncremental AttemptOrder = "incremental"
+	// AttemptOrderBulk creates the node, then all the paragraphs, then patches the node's relationships once.
+	// It makes fewer requests, but a failure part way through leaves the node without any paragraphs.
+	AttemptOrderBulk AttemptOrder = "bulk"
+	// AttemptOrderParagraphsFirst creates the paragraphs without a parent, then creates the node with its relationships.
+	// No node ever exists without its paragraphs, but the paragraphs are orphaned if creating the node fails.
+	AttemptOrderParagraphsFirst AttemptOrder = "paragraphs-first"
+)
+
+// ParseAttemptOrder converts the name of an attempt order into an AttemptOrder.
+func ParseAttemptOrder(name string) (AttemptOrder, error) {
+	switch o := AttemptOrder(name); o {
+	case AttemptOrderIncremental, AttemptOrderBulk, AttemptOrderParagraphsFirst:
+		return o, nil
+	default:
+		return "", fmt.Errorf("%w '%v'", ErrInvalidAttemptOrder, name)
+	}
+}
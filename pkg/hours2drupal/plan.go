@@ -0,0 +1,338 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// monthPlan is what an import does with one month's node, decided before anything is written.
+type monthPlan struct {
+	// Node is the month's node. Updated nodes have been looked up, and re-imported nodes have their ID.
+	Node HoursNode
+	// Days are the days which need a new paragraph.
+	Days []DailyHours
+	// Existing is set when the paragraphs are attached to a node which already exists.
+	Existing bool
+	// Updating is set when an existing node is updated and its old paragraphs are replaced.
+	Updating bool
+	// Reimported is set when the days are attached to the node a failed import created.
+	Reimported bool
+	// Replaced are the relationships to the paragraphs an update replaces.
+	Replaced []ParagraphRelationship
+	// Kept are the relationships to the paragraphs which already match a day, keyed by the day they match.
+	Kept map[string]ParagraphRelationship
+	// Patched are the paragraphs which already exist for a day, which are patched with only the fields
+	// in cfg.UpdateFields instead of being replaced.
+	Patched []patchedParagraph
+	// Skip is set when the month is skipped, because a node with its title already exists.
+	Skip bool
+	// Duplicates is the number of nodes with the same title which already exist, when another is created.
+	Duplicates int
+}
+
+// planMonth decides what the import does with the month's node and days, looking up the target
+// where the configuration calls for it. Nothing is written. The step is updated as the lookups are made.
+func planMonth(ctx context.Context, cfg Config, title string, days []DailyHours, nodeIDs map[string]string,
+	step *monthStep) (monthPlan, error) {
+	plan := monthPlan{Node: NewHoursNode(title, cfg.FieldMap), Days: days, Kept: map[string]ParagraphRelationship{}}
+
+	// Re-imported days are attached to the node a failed import already created.
+	reimportID, reimported := nodeIDs[title]
+	if reimported {
+		plan.Node.Data.ID = reimportID
+	}
+
+	plan.Reimported = reimported
+	plan.Existing = cfg.ParagraphsOnly || reimported
+
+	// Paragraphs only imports attach the days to nodes which must already exist.
+	if cfg.ParagraphsOnly {
+		step.Step = "looking up the node"
+
+		n, err := existingNode(ctx, cfg, title)
+		if err != nil {
+			return plan, err
+		}
+
+		plan.Node = n
+	}
+
+	// In update mode, an existing node for the month is reused and its paragraphs are replaced.
+	if !plan.Existing && cfg.Update {
+		step.Step = "looking up the node"
+
+		updating, err := plan.Node.Lookup(ctx, cfg)
+		if err != nil {
+			return plan, err
+		}
+
+		if updating {
+			plan.Existing = true
+			plan.Updating = true
+			plan.Replaced = plan.Node.Data.Relationships.Data
+			plan.Node.Data.Relationships.Data = nil
+		}
+
+		// Unchanged days keep their paragraphs, so they don't get a needless new revision.
+		if updating && cfg.SkipUnchanged {
+			step.Step = "comparing the existing paragraphs"
+
+			plan.Kept, plan.Days, plan.Replaced, err = splitUnchanged(ctx, cfg, plan.Replaced, days)
+			if err != nil {
+				return plan, err
+			}
+
+			for _, r := range plan.Kept {
+				plan.Node.Data.Relationships.Data = append(plan.Node.Data.Relationships.Data, r)
+			}
+		}
+
+		// When only some fields are updated, a day's paragraph is patched so the other fields keep their values.
+		if updating && cfg.UpdateFields != nil {
+			step.Step = "matching the existing paragraphs"
+
+			plan.Patched, plan.Days, plan.Replaced, err = splitPatched(ctx, cfg, plan.Replaced, plan.Days)
+			if err != nil {
+				return plan, err
+			}
+		}
+	}
+
+	// Check for a node from an earlier import of the same month before creating another.
+	if !plan.Existing && !cfg.Update {
+		step.Step = "checking for an existing node"
+
+		found, err := FindHoursNodes(ctx, cfg, title)
+		if err != nil {
+			return plan, err
+		}
+
+		plan.Skip = len(found) > 0 && cfg.SkipExisting
+		plan.Duplicates = len(found)
+	}
+
+	return plan, nil
+}
+
+// relinksExisting reports whether kept paragraphs replace some of the old ones, or patched paragraphs
+// have a new revision, so the node has to be relinked even when no new paragraphs are created.
+func (plan monthPlan) relinksExisting() bool {
+	return (len(plan.Kept) > 0 && len(plan.Replaced) > 0) || len(plan.Patched) > 0
+}
+
+// deletes returns the relationships to the paragraphs the update deletes once the node is relinked.
+// The node is only relinked, and the replaced paragraphs deleted, if there is something to link instead.
+func (plan monthPlan) deletes(cfg Config) []ParagraphRelationship {
+	if !plan.Updating || (len(plan.Days) == 0 && !plan.relinksExisting()) {
+		return nil
+	}
+
+	deleted := []ParagraphRelationship{}
+
+	for _, r := range plan.Replaced {
+		// Only paragraphs of the hours by day type were created by the tool.
+		if r.Type == cfg.FieldMap.ParagraphType {
+			deleted = append(deleted, r)
+		}
+	}
+
+	return deleted
+}
+
+// WritePlan writes a human readable plan of the changes an import would make to a file at path.
+// Each month is planned with the same decisions an import makes, so the target is read to find the
+// nodes which would be updated or skipped and the paragraphs which would be kept or deleted,
+// but nothing is written to it. Nodes are sorted by their earliest day and days are sorted within
+// each node, so the plan for the same input and target is identical between runs and can be
+// reviewed as a diff.
+func WritePlan(ctx context.Context, path string, months map[string][]DailyHours, nodeIDs map[string]string,
+	cfg Config) (err error) {
+	titles := []string{}
+
+	sorted := map[string][]DailyHours{}
+
+	for title, days := range months {
+		days = append([]DailyHours{}, days...)
+		sort.SliceStable(days, func(i, j int) bool {
+			return days[i].Day.Before(days[j].Day)
+		})
+
+		sorted[title] = days
+		titles = append(titles, title)
+	}
+
+	sort.Slice(titles, func(i, j int) bool {
+		a, b := sorted[titles[i]][0].Day, sorted[titles[j]][0].Day
+		if a.Equal(b) {
+			return titles[i] < titles[j]
+		}
+
+		return a.Before(b)
+	})
+
+	// Plan every month before creating the file, so a failed lookup doesn't leave a partial plan.
+	plans := []monthPlan{}
+	planTitles := []string{}
+
+	for _, month := range titles {
+		title, days, err := monthTitle(month, sorted[month], cfg)
+		if err != nil {
+			return err
+		}
+
+		step := monthStep{Title: title}
+
+		plan, err := planMonth(ctx, cfg, title, days, nodeIDs, &step)
+		if err != nil {
+			return fmt.Errorf("planning '%v' failed, %w", title, err)
+		}
+
+		plans = append(plans, plan)
+		planTitles = append(planTitles, title)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+
+	fmt.Fprintf(w, "# Plan for importing hours into %v.\n", cfg.Target)
+
+	for i, plan := range plans {
+		writeMonthPlan(w, planTitles[i], plan, cfg)
+	}
+
+	return w.Flush()
+}
+
+// planLine is a paragraph in a month's plan. Kept paragraphs don't have any hours,
+// and patched paragraphs have the ID of the paragraph which is patched.
+type planLine struct {
+	day string
+	h   *DailyHours
+	id  string
+}
+
+// writeMonthPlan writes the plan for one month's node and its paragraphs.
+func writeMonthPlan(w *bufio.Writer, title string, plan monthPlan, cfg Config) {
+	switch {
+	case plan.Skip:
+		fmt.Fprintf(w, "\nskip node %q, a node with this title already exists\n", title)
+		return
+	case plan.Existing:
+		fmt.Fprintf(w, "\nupdate node %q\n", title)
+	case plan.Duplicates > 0:
+		fmt.Fprintf(w, "\ncreate node %q, %v node(s) with this title already exist\n", title, plan.Duplicates)
+	default:
+		fmt.Fprintf(w, "\ncreate node %q\n", title)
+	}
+
+	// Kept, patched, and new paragraphs are listed together in calendar order, as they are linked.
+	lines := []planLine{}
+
+	for day := range plan.Kept {
+		lines = append(lines, planLine{day: day})
+	}
+
+	for i := range plan.Patched {
+		pp := &plan.Patched[i]
+		lines = append(lines, planLine{day: pp.Day.Day.Format("2006-01-02"), h: &pp.Day, id: pp.Relationship.ID})
+	}
+
+	for i := range plan.Days {
+		lines = append(lines, planLine{day: plan.Days[i].Day.Format("2006-01-02"), h: &plan.Days[i]})
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].day < lines[j].day
+	})
+
+	for _, l := range lines {
+		switch {
+		case l.h == nil:
+			fmt.Fprintf(w, "  keep paragraph %v, it is unchanged\n", l.day)
+		case l.id != "":
+			fmt.Fprintf(w, "  update paragraph %v (%v)\n", l.day, l.id)
+			writePlanDay(w, *l.h, cfg.UpdateFields)
+		default:
+			fmt.Fprintf(w, "  create paragraph %v\n", l.day)
+			writePlanDay(w, *l.h, nil)
+		}
+	}
+
+	for _, r := range plan.deletes(cfg) {
+		fmt.Fprintf(w, "  delete paragraph %v\n", r.ID)
+	}
+
+	if plan.Updating && len(plan.Days) == 0 && !plan.relinksExisting() {
+		fmt.Fprintf(w, "  no changes, the node is left untouched\n")
+	}
+}
+
+// writePlanDay writes the values sent for a day's paragraph. If fields isn't nil, only the values of the
+// fields in it are written, as only they are sent when a paragraph is patched.
+func writePlanDay(w *bufio.Writer, h DailyHours, fields map[string]bool) {
+	sent := func(field string) bool {
+		return fields == nil || fields[field]
+	}
+
+	if sent("building_hours") {
+		writePlanValue(w, "building hours", h.BuildingHours)
+	}
+
+	if sent("chat_hours") {
+		writePlanValue(w, "chat hours", h.ChatHours)
+	}
+
+	if sent("note") {
+		writePlanValue(w, "note", h.Note)
+	}
+
+	if fields == nil {
+		writePlanValue(w, "reference", h.Reference)
+	}
+
+	if h.Holiday && sent("holiday") {
+		writePlanValue(w, "holiday", "true")
+	}
+
+	extras := []string{}
+	for field := range h.Extra {
+		extras = append(extras, field)
+	}
+
+	sort.Strings(extras)
+
+	for _, field := range extras {
+		if sent(field) {
+			writePlanValue(w, field, h.Extra[field])
+		}
+	}
+}
+
+// writePlanValue writes one of a paragraph's values to the plan, quoted so that whitespace is visible.
+// Empty values are left out.
+func writePlanValue(w *bufio.Writer, name, value string) {
+	value = strings.TrimSpace(value)
+	if value != "" {
+		fmt.Fprintf(w, "    %v: %q\n", name, value)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// clearLine returns the cursor to the start of the line and clears it, on a terminal.
+const clearLine = "\r\x1b[K"
+
+// Progress writes progress messages, and is safe to use from multiple goroutines.
+// Each call writes its whole message at once, so messages from concurrent
+// workers never interleave, as long as each message is a complete line.
+type Progress struct {
+	mu sync.Mutex
+	w  io.Writer
+	// status enables the status line, which is redrawn in place after the current line.
+	status bool
+	// line is what has been written since the last newline, so it can be redrawn with the status.
+	line string
+	// shown is the status currently drawn after the line.
+	shown string
+}
+
+// NewProgress creates a Progress which writes to w.
+func NewProgress(w io.Writer) *Progress {
+	return &Progress{w: w}
+}
+
+// EnableStatus turns on the status line. It should only be used when the writer is a terminal,
+// since the status is redrawn in place using a carriage return and an escape sequence.
+func (p *Progress) EnableStatus() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.status = true
+}
+
+// Printf formats and writes a progress message.
+func (p *Progress) Printf(format string, a ...interface{}) {
+	_, _ = p.Write([]byte(fmt.Sprintf(format, a...)))
+}
+
+// Write writes p as a single progress message, so a Progress can be used as an io.Writer.
+// A status line being shown is cleared first, so the message replaces it.
+func (p *Progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.shown != "" {
+		fmt.Fprint(p.w, clearLine+p.line)
+		p.shown = ""
+	}
+
+	if p.status {
+		s := p.line + string(b)
+		p.line = s[strings.LastIndex(s, "\n")+1:]
+	}
+
+	return p.w.Write(b)
+}
+
+// Status shows a status message after the current line, like "[3/12 months] creating paragraph 12/31",
+// replacing the last status. It does nothing unless the status line is enabled.
+func (p *Progress) Status(format string, a ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.status {
+		return
+	}
+
+	p.shown = fmt.Sprintf(format, a...)
+	fmt.Fprint(p.w, clearLine+p.line+" "+p.shown)
+}
+
+// progress returns the configured progress writer, or one which writes to stdout if none was configured.
+func (cfg Config) progress() *Progress {
+	if cfg.Progress == nil {
+		return NewProgress(os.Stdout)
+	}
+
+	return cfg.Progress
+}
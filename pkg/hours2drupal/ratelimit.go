@@ -0,0 +1,21 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"golang.org/x/time/rate"
+)
+
+// NewRateLimiter creates a limiter which allows perSecond requests each second. The burst is one request,
+// so requests are spaced out evenly, including concurrent ones.
+// A rate of zero returns nil, which disables rate limiting.
+func NewRateLimiter(perSecond float64) *rate.Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+
+	return rate.NewLimiter(rate.Limit(perSecond), 1)
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Redacted replaces secrets in log output.
+const Redacted = "[REDACTED]"
+
+// DefaultRedactedHeaders are the headers whose values are always redacted.
+const DefaultRedactedHeaders = "Authorization,Proxy-Authorization,Cookie,Set-Cookie"
+
+// Redactor hides secrets from everything the tool writes.
+// A nil Redactor leaves its input unchanged.
+type Redactor struct {
+	secrets []string
+	headers map[string]bool
+}
+
+// NewRedactor creates a Redactor which hides the secrets, and the values of the comma separated headers.
+// The basic auth credentials built from each username:password pair are hidden too, since they appear
+// in the Authorization header.
+func NewRedactor(headers string, credentials map[string]string, secrets ...string) *Redactor {
+	r := &Redactor{headers: map[string]bool{}}
+
+	for _, name := range strings.Split(headers, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			r.headers[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+
+	for username, password := range credentials {
+		secrets = append(secrets, password, base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	}
+
+	for _, s := range secrets {
+		if s != "" {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+
+	// Replace longer secrets first, so a secret which contains another is hidden entirely.
+	sort.Slice(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+
+	return r
+}
+
+// Redact replaces every secret in s.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+
+	return s
+}
+
+// RedactHeader returns a copy of the header with the values of redacted headers replaced,
+// for writing requests and responses to logs.
+func (r *Redactor) RedactHeader(h http.Header) http.Header {
+	c := h.Clone()
+
+	for name, values := range c {
+		for i := range values {
+			if r != nil && r.headers[http.CanonicalHeaderKey(name)] {
+				values[i] = Redacted
+			} else {
+				values[i] = r.Redact(values[i])
+			}
+		}
+	}
+
+	return c
+}
+
+// Writer returns a writer which redacts what is written before passing it on to w.
+// Secrets split across writes aren't found, so each write should be a complete message.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	if r == nil {
+		return w
+	}
+
+	return redactingWriter{r: r, w: w}
+}
+
+// redactingWriter redacts each write before passing it on.
+type redactingWriter struct {
+	r *Redactor
+	w io.Writer
+}
+
+// Write redacts p and writes it to the underlying writer.
+func (rw redactingWriter) Write(p []byte) (int, error) {
+	_, err := io.WriteString(rw.w, rw.r.Redact(string(p)))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
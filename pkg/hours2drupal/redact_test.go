@@ -0,0 +1,178 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoServer rejects every write, echoing the request's credentials in its error, like a misbehaving proxy might.
+func echoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeHeader)
+
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"data":[]}`))
+			return
+		}
+
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"errors":[{"title":"Unprocessable Entity","detail":"rejected credentials ` +
+			r.Header.Get("Authorization") + ` ` + r.Header.Get(DefaultAPIKeyHeader) + `"}]}`))
+	}))
+}
+
+// captureLog sends the standard logger's output, which -verbose and -trace write to, to w until the test ends.
+func captureLog(t *testing.T, w *bytes.Buffer, r *Redactor) {
+	flags := log.Flags()
+	log.SetOutput(r.Writer(w))
+	log.SetFlags(0)
+
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	})
+}
+
+func TestSecretsAreRedactedFromEveryOutput(t *testing.T) {
+	const (
+		username = "hours-importer"
+		password = "hunter2-password"
+		token    = "bearer-token-0123456789"
+		apiKey   = "api-key-9876543210"
+	)
+
+	basic := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+
+	tests := []struct {
+		name      string
+		configure func(cfg *Config)
+		secrets   []string
+	}{
+		{
+			name:      "basic auth",
+			configure: func(cfg *Config) {},
+			secrets:   []string{password, basic, "Basic " + basic},
+		},
+		{
+			name:      "bearer token",
+			configure: func(cfg *Config) { cfg.BearerToken = token },
+			secrets:   []string{token, "Bearer " + token},
+		},
+		{
+			name:      "API key",
+			configure: func(cfg *Config) { cfg.APIKey = apiKey },
+			secrets:   []string{apiKey},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := echoServer()
+			defer s.Close()
+
+			out := &bytes.Buffer{}
+			r := NewRedactor(DefaultRedactedHeaders+","+DefaultAPIKeyHeader,
+				map[string]string{username: password}, token, apiKey)
+
+			captureLog(t, out, r)
+
+			cfg := testServerConfig(s)
+			cfg.Username = username
+			cfg.Password = password
+			cfg.AssumeYes = true
+			cfg.Verbose = true
+			cfg.Trace = true
+			cfg.Redactor = r
+			cfg.Progress = NewProgress(r.Writer(out))
+			cfg.Logger, _ = NewLogger(LogFormatJSON, r.Writer(out))
+			tt.configure(&cfg)
+
+			day := DailyHours{Day: time.Date(2025, time.January, 6, 12, 0, 0, 0, time.UTC), BuildingHours: "9-5", ChatHours: "10-4"}
+
+			result, err := ImportHours(context.Background(), []DailyHours{day}, nil, cfg)
+			if !errors.Is(err, ErrAPIError) {
+				t.Fatalf("ImportHours() = %v, want %v", err, ErrAPIError)
+			}
+
+			path := filepath.Join(t.TempDir(), "result.json")
+
+			err = WriteResultJSON(path, []TargetResult{{Target: cfg.BaseURL(), Result: result, Err: err}}, r)
+			if err != nil {
+				t.Fatalf("WriteResultJSON() failed, %v", err)
+			}
+
+			resultJSON, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			outputs := map[string]string{"log": out.String(), "result JSON": string(resultJSON)}
+
+			// Make sure each output was actually written, so the checks below aren't vacuous.
+			for name, want := range map[string]string{"log": "Request: POST", "result JSON": "rejected credentials"} {
+				if !strings.Contains(outputs[name], want) {
+					t.Fatalf("the %v doesn't contain %q:\n%v", name, want, outputs[name])
+				}
+			}
+
+			for _, want := range []string{"Trace: POST", `"msg":"month started"`} {
+				if !strings.Contains(out.String(), want) {
+					t.Fatalf("the log doesn't contain %q:\n%v", want, out.String())
+				}
+			}
+
+			for name, output := range outputs {
+				for _, secret := range tt.secrets {
+					if strings.Contains(output, secret) {
+						t.Errorf("the %v contains the secret %q:\n%v", name, secret, output)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestVerboseHidesCredentialHeadersWithoutRedaction(t *testing.T) {
+	s := echoServer()
+	defer s.Close()
+
+	out := &bytes.Buffer{}
+	captureLog(t, out, nil)
+
+	for _, configure := range []func(cfg *Config){
+		func(cfg *Config) {},
+		func(cfg *Config) { cfg.BearerToken = "bearer-token-0123456789" },
+		func(cfg *Config) { cfg.APIKey = "api-key-9876543210" },
+	} {
+		cfg := testServerConfig(s)
+		cfg.Verbose = true
+		configure(&cfg)
+
+		_, _ = callAPI(context.Background(), cfg, s.URL+HoursPath, http.MethodGet, &struct{}{}, nil)
+	}
+
+	for _, secret := range []string{"Basic ", "bearer-token-0123456789", "api-key-9876543210"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("the verbose log contains %q:\n%v", secret, out.String())
+		}
+	}
+
+	if strings.Count(out.String(), Redacted) < 3 {
+		t.Errorf("the verbose log doesn't show the credential headers as %v:\n%v", Redacted, out.String())
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Result summarizes what an import created in the target.
+// When an import fails, the result describes what was created before the failure.
+type Result struct {
+	Nodes []NodeResult
+	// Failed lists the months which failed to import with -keep-going.
+	Failed   []MonthFailure
+	Duration time.Duration
+}
+
+// MonthFailure describes a month which failed to import, and why.
+type MonthFailure struct {
+	Title string
+	Err   error
+}
+
+// NodeResult describes an hours node and the paragraphs attached to it.
+type NodeResult struct {
+	Title string
+	ID    string
+	// InternalID is the node's numeric ID, if the target returned it.
+	InternalID int
+	// Existing is true if the node already existed, rather than being created by the import.
+	Existing   bool
+	Paragraphs []ParagraphResult
+	Duration   time.Duration
+}
+
+// ParagraphResult describes an hours by day paragraph.
+type ParagraphResult struct {
+	Day string
+	ID  string
+	// InternalID is the paragraph's numeric ID, if the target returned it.
+	InternalID int
+	RevisionID int
+	// Linked is set once the node references the paragraph. A paragraph which was created
+	// but never linked, because the import failed, doesn't count as an imported day.
+	Linked bool
+}
+
+// Days returns the number of days which were imported, which is the number of linked paragraphs.
+func (r Result) Days() int {
+	days := 0
+
+	for _, n := range r.Nodes {
+		days += n.linked()
+	}
+
+	return days
+}
+
+// linked returns the number of the node's paragraphs which it references.
+func (n NodeResult) linked() int {
+	linked := 0
+
+	for _, p := range n.Paragraphs {
+		if p.Linked {
+			linked++
+		}
+	}
+
+	return linked
+}
+
+// WriteSummary writes a report of the nodes and paragraphs in the result to w, with a line for each month.
+func (r Result) WriteSummary(w io.Writer) {
+	created := 0
+
+	for _, n := range r.Nodes {
+		state := "created"
+		if n.Existing {
+			state = "existing"
+		} else {
+			created++
+		}
+
+		unlinked := ""
+		if l := n.linked(); l < len(n.Paragraphs) {
+			unlinked = fmt.Sprintf(" (%v created but not linked)", len(n.Paragraphs)-l)
+		}
+
+		fmt.Fprintf(w, "  %v: %v paragraphs%v, %v node %v, in %v.\n",
+			n.Title, n.linked(), unlinked, state, n.ID, n.Duration.Round(time.Millisecond))
+	}
+
+	fmt.Fprintf(w, "Created %v month nodes and %v daily paragraphs across %v months in %v.\n",
+		created, r.Days(), len(r.Nodes), r.Duration.Round(time.Millisecond))
+}
+
+// WriteFailures writes the months which failed to import to w, with a line for each month and its error.
+func (r Result) WriteFailures(w io.Writer) {
+	fmt.Fprintf(w, "%v months failed to import:\n", len(r.Failed))
+
+	for _, f := range r.Failed {
+		fmt.Fprintf(w, "  %v: %v.\n", f.Title, f.Err)
+	}
+}
+
+// TargetResult is the result of an import into one target, and the error which stopped it, if any.
+type TargetResult struct {
+	Target string
+	Result Result
+	Err    error
+}
+
+// resultDocument is the JSON document written by WriteResultJSON.
+type resultDocument struct {
+	Success bool             `json:"success"`
+	Targets []targetDocument `json:"targets"`
+}
+
+// targetDocument describes the import into one target.
+type targetDocument struct {
+	Target   string          `json:"target"`
+	Success  bool            `json:"success"`
+	Error    string          `json:"error,omitempty"`
+	Duration string          `json:"duration"`
+	Months   []monthDocument `json:"months"`
+}
+
+// monthDocument describes one month's node and paragraphs, or the error which stopped the month.
+type monthDocument struct {
+	Title          string              `json:"title"`
+	NodeID         string              `json:"node_id,omitempty"`
+	NodeInternalID int                 `json:"node_internal_id,omitempty"`
+	Existing       bool                `json:"existing"`
+	Paragraphs     []paragraphDocument `json:"paragraphs"`
+	Error          string              `json:"error,omitempty"`
+}
+
+// paragraphDocument describes one day's paragraph.
+type paragraphDocument struct {
+	Day        string `json:"day"`
+	ID         string `json:"id"`
+	InternalID int    `json:"internal_id,omitempty"`
+	RevisionID int    `json:"revision_id,omitempty"`
+	Linked     bool   `json:"linked"`
+}
+
+// WriteResultJSON writes the results of the imports, with each month's node and paragraphs and any errors,
+// to the JSON file at path, so they can be read by other tools. Secrets in the errors are hidden by the redactor.
+func WriteResultJSON(path string, results []TargetResult, r *Redactor) error {
+	doc := resultDocument{Success: true, Targets: []targetDocument{}}
+
+	for _, tr := range results {
+		t := targetDocument{
+			Target:   tr.Target,
+			Success:  tr.Err == nil,
+			Duration: tr.Result.Duration.String(),
+			Months:   []monthDocument{},
+		}
+
+		if tr.Err != nil {
+			t.Error = r.Redact(tr.Err.Error())
+			doc.Success = false
+		}
+
+		for _, n := range tr.Result.Nodes {
+			m := monthDocument{
+				Title:          n.Title,
+				NodeID:         n.ID,
+				NodeInternalID: n.InternalID,
+				Existing:       n.Existing,
+				Paragraphs:     []paragraphDocument{},
+			}
+
+			for _, p := range n.Paragraphs {
+				m.Paragraphs = append(m.Paragraphs, paragraphDocument{
+					Day:        p.Day,
+					ID:         p.ID,
+					InternalID: p.InternalID,
+					RevisionID: p.RevisionID,
+					Linked:     p.Linked,
+				})
+			}
+
+			t.Months = append(t.Months, m)
+		}
+
+		for _, f := range tr.Result.Failed {
+			t.Months = append(t.Months, monthDocument{Title: f.Title, Paragraphs: []paragraphDocument{}, Error: r.Redact(f.Err.Error())})
+		}
+
+		doc.Targets = append(doc.Targets, t)
+	}
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryBaseDelay is the delay before the first retry of a failed request, which doubles with each retry.
+const RetryBaseDelay = time.Second
+
+// MaxRetryDelay is the longest the tool will wait before retrying a request, even if the server asks for longer.
+const MaxRetryDelay = 5 * time.Minute
+
+// retryDelay reports whether a request which failed with err should be retried, and how long to wait first.
+// Rate limiting, gateway errors, timeouts, and failed connections are retried, unless the context was cancelled
+// or the request has already been retried maxRetries times. A POST which reached the server may have created
+// something even though it failed, so it's only retried if it was never sent, or if the server asked for it to be
+// retried later with a 429 or 503 response and a Retry-After header.
+func retryDelay(ctx context.Context, method string, err error, attempt, maxRetries int) (time.Duration, bool) {
+	if err == nil || attempt >= maxRetries || ctx.Err() != nil {
+		return 0, false
+	}
+
+	idempotent := method != http.MethodPost
+
+	var apiErr *APIError
+
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			if d, ok := parseRetryAfter(apiErr.RetryAfter, time.Now()); ok {
+				return d, true
+			}
+		case http.StatusBadGateway, http.StatusGatewayTimeout:
+		default:
+			return 0, false
+		}
+
+		return backoff(attempt), idempotent
+	}
+
+	// A request which couldn't connect was never sent.
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return backoff(attempt), true
+	}
+
+	var netErr net.Error
+	if (errors.As(err, &netErr) && netErr.Timeout()) || errors.Is(err, context.DeadlineExceeded) {
+		return backoff(attempt), idempotent
+	}
+
+	return 0, false
+}
+
+// backoff returns an exponentially increasing delay for the attempt, with jitter
+// so that concurrent requests don't all retry at the same moment.
+func backoff(attempt int) time.Duration {
+	d := RetryBaseDelay << uint(attempt)
+	if d <= 0 || d > MaxRetryDelay {
+		d = MaxRetryDelay
+	}
+
+	// Wait somewhere between half and all of the delay.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1)) //nolint:gosec
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	var d time.Duration
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = t.Sub(now)
+	} else {
+		return 0, false
+	}
+
+	if d < 0 {
+		d = 0
+	}
+
+	if d > MaxRetryDelay {
+		d = MaxRetryDelay
+	}
+
+	return d, true
+}
+
+// retryReason describes why a request is being retried, without the response body of an APIError.
+func retryReason(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return fmt.Sprintf("[%v]", apiErr.StatusCode)
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRetryDelayOnlyRetriesUnsentPosts(t *testing.T) {
+	dial := &url.Error{Op: "Post", URL: "http://localhost", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	reset := &url.Error{Op: "Post", URL: "http://localhost", Err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}}
+	status := func(code int, retryAfter string) error {
+		return fmt.Errorf("creating node failed, %w", &APIError{StatusCode: code, RetryAfter: retryAfter})
+	}
+
+	tests := []struct {
+		name      string
+		err       error
+		post, get bool
+	}{
+		{name: "dial error", err: dial, post: true, get: true},
+		{name: "read error", err: reset, post: false, get: false},
+		{name: "timeout", err: context.DeadlineExceeded, post: false, get: true},
+		{name: "429 with Retry-After", err: status(http.StatusTooManyRequests, "1"), post: true, get: true},
+		{name: "429", err: status(http.StatusTooManyRequests, ""), post: false, get: true},
+		{name: "503 with Retry-After", err: status(http.StatusServiceUnavailable, "1"), post: true, get: true},
+		{name: "503", err: status(http.StatusServiceUnavailable, ""), post: false, get: true},
+		{name: "502", err: status(http.StatusBadGateway, ""), post: false, get: true},
+		{name: "504", err: status(http.StatusGatewayTimeout, "1"), post: false, get: true},
+		{name: "422", err: status(http.StatusUnprocessableEntity, ""), post: false, get: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for method, want := range map[string]bool{http.MethodPost: tt.post, http.MethodGet: tt.get} {
+				if _, got := retryDelay(context.Background(), method, tt.err, 0, 3); got != want {
+					t.Errorf("retryDelay(%v) = %v, want %v", method, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrRollbackIncomplete is an error which is returned when some of the created nodes or paragraphs couldn't be deleted.
+var ErrRollbackIncomplete = errors.New("the rollback did not delete everything")
+
+// Rollback records the IDs of the nodes and paragraphs an import creates, so a failed import can be undone.
+// A nil Rollback records nothing.
+type Rollback struct {
+	mu         sync.Mutex
+	nodes      []string
+	paragraphs []string
+}
+
+// NewRollback creates a Rollback if enabled is true, and returns nil otherwise.
+func NewRollback(enabled bool) *Rollback {
+	if !enabled {
+		return nil
+	}
+
+	return &Rollback{}
+}
+
+// AddNode records that the node with the ID was created.
+func (r *Rollback) AddNode(id string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nodes = append(r.nodes, id)
+}
+
+// AddParagraph records that the paragraph with the ID was created.
+func (r *Rollback) AddParagraph(id string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.paragraphs = append(r.paragraphs, id)
+}
+
+// Counts returns the number of nodes and paragraphs which were recorded.
+func (r *Rollback) Counts() (nodes, paragraphs int) {
+	if r == nil {
+		return 0, 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.nodes), len(r.paragraphs)
+}
+
+// Undo deletes the recorded paragraphs, then the recorded nodes, newest first.
+// A failed delete doesn't stop the others, and the IDs which couldn't be deleted are listed in the error.
+func (r *Rollback) Undo(ctx context.Context, cfg Config) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	failed := []string{}
+
+	for i := len(r.paragraphs) - 1; i >= 0; i-- {
+		p := HoursByDayParagraph{}
+		p.Data.ID = r.paragraphs[i]
+
+		err := p.Delete(ctx, cfg)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("paragraph %v: %v", p.Data.ID, err))
+		}
+	}
+
+	for i := len(r.nodes) - 1; i >= 0; i-- {
+		n := NewHoursNode("", cfg.FieldMap)
+		n.Data.ID = r.nodes[i]
+
+		err := n.Delete(ctx, cfg)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("node %v: %v", n.Data.ID, err))
+		}
+	}
+
+	r.nodes, r.paragraphs = nil, nil
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%w, %v", ErrRollbackIncomplete, strings.Join(failed, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// DefaultAllowedNoteTags is the default list of HTML tags which are kept when sanitizing notes.
+const DefaultAllowedNoteTags = "a,b,br,em,i,li,ol,p,strong,ul"
+
+// SanitizeHTML removes disallowed HTML from s.
+// The contents of script and style elements are removed entirely. Other tags
+// which aren't in allowed are removed but their text is kept. All attributes
+// are removed from allowed tags, except for href on links with a safe scheme.
+func SanitizeHTML(s string, allowed map[string]bool) string {
+	b := &strings.Builder{}
+	z := html.NewTokenizer(strings.NewReader(s))
+
+	// Keep track of whether we are inside a script or style element.
+	skipping := ""
+
+	for {
+		tt := z.Next()
+
+		if tt == html.ErrorToken {
+			if !errors.Is(z.Err(), io.EOF) {
+				// The tokenizer only fails on EOF when reading from a string, but be safe.
+				return html.EscapeString(s)
+			}
+
+			return b.String()
+		}
+
+		t := z.Token()
+
+		if skipping != "" {
+			if tt == html.EndTagToken && t.Data == skipping {
+				skipping = ""
+			}
+
+			continue
+		}
+
+		switch tt {
+		case html.TextToken:
+			b.WriteString(html.EscapeString(t.Data))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if t.Data == "script" || t.Data == "style" {
+				if tt == html.StartTagToken {
+					skipping = t.Data
+				}
+
+				continue
+			}
+
+			if allowed[t.Data] {
+				t.Attr = safeAttributes(t)
+				b.WriteString(t.String())
+			}
+		case html.EndTagToken:
+			if allowed[t.Data] {
+				b.WriteString(t.String())
+			}
+		case html.ErrorToken, html.CommentToken, html.DoctypeToken:
+			// Comments and doctypes are dropped.
+		}
+	}
+}
+
+// safeAttributes returns the attributes of the token which are safe to keep.
+func safeAttributes(t html.Token) []html.Attribute {
+	if t.Data != "a" {
+		return nil
+	}
+
+	for _, a := range t.Attr {
+		if a.Key != "href" {
+			continue
+		}
+
+		href := strings.ToLower(strings.TrimSpace(a.Val))
+		if strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") ||
+			strings.HasPrefix(href, "mailto:") {
+			return []html.Attribute{{Key: "href", Val: a.Val}}
+		}
+	}
+
+	return nil
+}
+
+// ParseAllowedTags converts a comma separated list of tag names into a set.
+func ParseAllowedTags(list string) map[string]bool {
+	allowed := map[string]bool{}
+
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" {
+			allowed[tag] = true
+		}
+	}
+
+	return allowed
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// checkSmallMonths warns about months with fewer than cfg.MinMonthDays days, which are usually
+// a mistyped date creating a stray month node, like 2052 typed for 2025. Imports of a single month,
+// and months being finished from a manifest, are expected to be small and aren't checked. Only months are
+// checked, since weeks are small anyway, and days given a node title in the CSV are left out, since they were
+// grouped on purpose. With cfg.Strict the warning is an error.
+func checkSmallMonths(hours []DailyHours, nodeIDs map[string]string, cfg Config) error {
+	if cfg.MinMonthDays <= 0 || (cfg.GroupBy != "" && cfg.GroupBy != GroupByMonth) {
+		return nil
+	}
+
+	months := map[string][]DailyHours{}
+
+	for _, h := range hours {
+		if h.NodeTitle != "" {
+			continue
+		}
+
+		title := groupTitle(h.Day, cfg.FieldMap.TitleFormat, GroupByMonth)
+		months[title] = append(months[title], h)
+	}
+
+	if len(months) < 2 {
+		return nil
+	}
+
+	titles := []string{}
+
+	for title, days := range months {
+		if _, ok := nodeIDs[title]; ok || len(days) >= cfg.MinMonthDays {
+			continue
+		}
+
+		titles = append(titles, title)
+	}
+
+	sort.Strings(titles)
+
+	for _, title := range titles {
+		days := []string{}
+		for _, h := range months[title] {
+			days = append(days, h.Day.Format("2006-01-02"))
+		}
+
+		sort.Strings(days)
+
+		if cfg.Strict {
+			return fmt.Errorf("%w: '%v' has only %v day(s) (%v), check the dates are correct",
+				ErrSmallMonth, title, len(days), strings.Join(days, ", "))
+		}
+
+		cfg.progress().Printf("Warning: '%v' has only %v day(s) (%v), check the dates are correct.\n",
+			title, len(days), strings.Join(days, ", "))
+		cfg.LogEvent(slog.LevelWarn, "small month", "month", title, "days", len(days))
+	}
+
+	return nil
+}
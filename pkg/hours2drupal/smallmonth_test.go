@@ -0,0 +1,72 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCheckSmallMonths(t *testing.T) {
+	day := func(month time.Month, d int, nodeTitle string) DailyHours {
+		return DailyHours{Day: time.Date(2025, month, d, 12, 0, 0, 0, time.UTC), NodeTitle: nodeTitle}
+	}
+
+	january := []DailyHours{day(time.January, 6, ""), day(time.January, 7, ""), day(time.January, 8, "")}
+
+	tests := []struct {
+		name     string
+		hours    []DailyHours
+		grouping Grouping
+		want     error
+	}{
+		{
+			name:  "stray month",
+			hours: append([]DailyHours{day(time.February, 1, "")}, january...),
+			want:  ErrSmallMonth,
+		},
+		{
+			name:     "stray month grouped by month",
+			hours:    append([]DailyHours{day(time.February, 1, "")}, january...),
+			grouping: GroupByMonth,
+			want:     ErrSmallMonth,
+		},
+		{
+			name:  "full months",
+			hours: append([]DailyHours{day(time.February, 1, ""), day(time.February, 2, "")}, january...),
+		},
+		{
+			name:     "weeks",
+			hours:    append([]DailyHours{day(time.January, 13, "")}, january...),
+			grouping: GroupByWeek,
+		},
+		{
+			name:  "node title override",
+			hours: append([]DailyHours{day(time.February, 14, "Reading week")}, january...),
+		},
+		{
+			name: "node title overrides which would make one month small",
+			hours: append([]DailyHours{
+				day(time.February, 1, ""), day(time.February, 2, "Reading week"), day(time.February, 3, "Reading week"),
+			}, january...),
+			want: ErrSmallMonth,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{FieldMap: DefaultFieldMap(), GroupBy: tt.grouping, MinMonthDays: 2, Strict: true}
+			cfg.Progress = NewProgress(io.Discard)
+
+			err := checkSmallMonths(tt.hours, nil, cfg)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("checkSmallMonths() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"net/url"
+	"strings"
+)
+
+// sparseParagraphURL requests only the paragraph attributes the tool reads from responses, when cfg.Sparse is set.
+func sparseParagraphURL(u string, cfg Config) string {
+	return sparseURL(u, cfg, cfg.FieldMap.ParagraphType,
+		"drupal_internal__id", "drupal_internal__revision_id", "parent_id", "parent_type", "parent_field_name")
+}
+
+// sparseNodeURL requests only the node title, node ID, and paragraph reference field from responses,
+// when cfg.Sparse is set. The reference field is needed to check the target kept the node's relationships.
+func sparseNodeURL(u string, cfg Config) string {
+	return sparseURL(u, cfg, cfg.FieldMap.NodeType, "title", "drupal_internal__nid", cfg.FieldMap.NodeField)
+}
+
+// sparseURL adds a JSON:API sparse fieldset for the resource type to the URL, when cfg.Sparse is set.
+func sparseURL(u string, cfg Config, resourceType string, fields ...string) string {
+	if !cfg.Sparse {
+		return u
+	}
+
+	q := url.Values{}
+	q.Set("fields["+resourceType+"]", strings.Join(fields, ","))
+
+	sep := "?"
+	if strings.Contains(u, "?") {
+		sep = "&"
+	}
+
+	return u + sep + q.Encode()
+}
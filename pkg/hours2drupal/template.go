@@ -0,0 +1,179 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrInvalidTemplate is an error which is returned when a week template can't be used.
+var ErrInvalidTemplate = errors.New("invalid week template")
+
+// WeekdayColumn is the CSV header of the week template column which names the day of the week.
+const WeekdayColumn = "weekday"
+
+// WeekTemplate holds the hours of a regular week, keyed by day of the week.
+type WeekTemplate map[time.Weekday]DailyHours
+
+// LoadWeekTemplate reads a week template from a CSV file at path. The file has a weekday column,
+// holding the English name of the day like "Monday", and the note, building hours, and chat hours
+// columns named in the config's field map. Days of the week without a line are left out when expanded.
+// The file is read like the hours CSV files, with the config's input encoding, delimiter, and comment character.
+func LoadWeekTemplate(path string, cfg Config) (WeekTemplate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := decodeInput(f, cfg.InputEncoding)
+	if err != nil {
+		return nil, fmt.Errorf("processing week template '%v' failed, %w", path, err)
+	}
+
+	t, err := parseWeekTemplate(cfg.csvReader(r), cfg.FieldMap)
+	if err != nil {
+		return nil, fmt.Errorf("processing week template '%v' failed, %w", path, err)
+	}
+
+	return t, nil
+}
+
+// parseWeekTemplate reads the week template's header and lines from the CSV reader.
+func parseWeekTemplate(r *csv.Reader, fm FieldMap) (WeekTemplate, error) {
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, ErrNoHeader
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	h := map[string]int{}
+	for i, name := range header {
+		h[strings.TrimSpace(name)] = i
+	}
+
+	for _, column := range []string{WeekdayColumn, fm.Columns.BuildingHours, fm.Columns.ChatHours} {
+		if _, ok := h[column]; !ok {
+			return nil, fmt.Errorf("%w: column '%v' not found", ErrInvalidHeader, column)
+		}
+	}
+
+	weekdays := map[string]time.Weekday{}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		weekdays[strings.ToLower(d.String())] = d
+	}
+
+	t := WeekTemplate{}
+
+	for lineNum := 2; ; lineNum++ {
+		l, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSpace(l[h[WeekdayColumn]])
+
+		d, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("%w: '%v' on line %v is not a day of the week", ErrInvalidTemplate, name, lineNum)
+		}
+
+		if _, ok := t[d]; ok {
+			return nil, fmt.Errorf("%w: %v is repeated on line %v", ErrInvalidTemplate, d, lineNum)
+		}
+
+		day := DailyHours{
+			BuildingHours: strings.TrimSpace(l[h[fm.Columns.BuildingHours]]),
+			ChatHours:     strings.TrimSpace(l[h[fm.Columns.ChatHours]]),
+		}
+
+		if i, ok := h[fm.Columns.Note]; ok {
+			day.Note = strings.TrimSpace(l[i])
+		}
+
+		if day.BuildingHours == "" || day.ChatHours == "" {
+			return nil, fmt.Errorf("%w: empty hours on line %v", ErrMissingData, lineNum)
+		}
+
+		t[d] = day
+	}
+
+	return t, nil
+}
+
+// ParseDateRange parses a range of days in the form 2006-01-02:2006-01-31 in loc, including both ends.
+func ParseDateRange(s string, loc *time.Location) (start, end time.Time, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return start, end, fmt.Errorf("%w: the range '%v' must be in the form 2006-01-02:2006-01-31", ErrInvalidData, s)
+	}
+
+	start, err = parseDay("2006-01-02", strings.TrimSpace(parts[0]), loc)
+	if err != nil {
+		return start, end, fmt.Errorf("%w: the range start: %v", ErrInvalidData, err)
+	}
+
+	end, err = parseDay("2006-01-02", strings.TrimSpace(parts[1]), loc)
+	if err != nil {
+		return start, end, fmt.Errorf("%w: the range end: %v", ErrInvalidData, err)
+	}
+
+	if end.Before(start) {
+		return start, end, fmt.Errorf("%w: the range '%v' ends before it starts", ErrInvalidData, s)
+	}
+
+	return start, end, nil
+}
+
+// Expand returns the hours of every day from start to end, including both, using the template for the day of the week.
+func (t WeekTemplate) Expand(start, end time.Time) []DailyHours {
+	hours := []DailyHours{}
+
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		h, ok := t[d.Weekday()]
+		if !ok {
+			continue
+		}
+
+		h.Day = d
+		hours = append(hours, h)
+	}
+
+	return hours
+}
+
+// applyOverrides replaces the days in hours with the day from overrides on the same date, if there is one.
+// Overrides for dates which aren't in hours are added to the end.
+func applyOverrides(hours, overrides []DailyHours) []DailyHours {
+	byDate := map[string]int{}
+	for i, h := range hours {
+		byDate[h.Day.Format("2006-01-02")] = i
+	}
+
+	for _, o := range overrides {
+		if i, ok := byDate[o.Day.Format("2006-01-02")]; ok {
+			hours[i] = o
+			continue
+		}
+
+		hours = append(hours, o)
+	}
+
+	return hours
+}
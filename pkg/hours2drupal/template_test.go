@@ -0,0 +1,72 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestLoadWeekTemplateReadsLikeHours(t *testing.T) {
+	want := WeekTemplate{
+		time.Monday:   {Note: "Café open", BuildingHours: "8am-10pm", ChatHours: "10am-6pm"},
+		time.Saturday: {BuildingHours: "10am-6pm", ChatHours: "closed"},
+	}
+
+	tests := []struct {
+		name      string
+		file      []byte
+		configure func(cfg *Config)
+	}{
+		{
+			name: "byte order mark",
+			file: []byte(utf8BOM + "weekday,note,building hours,chat hours\n" +
+				"Monday,Café open,8am-10pm,10am-6pm\nSaturday,,10am-6pm,closed\n"),
+			configure: func(cfg *Config) {},
+		},
+		{
+			name: "delimiter and comment",
+			file: []byte("weekday;note;building hours;chat hours\n# Fall term\n" +
+				"Monday;Café open;8am-10pm;10am-6pm\nSaturday;;10am-6pm;closed\n"),
+			configure: func(cfg *Config) {
+				cfg.Delimiter = ';'
+				cfg.Comment = '#'
+			},
+		},
+		{
+			name: "input encoding",
+			file: []byte("weekday,note,building hours,chat hours\n" +
+				"Monday,Caf\xe9 open,8am-10pm,10am-6pm\nSaturday,,10am-6pm,closed\n"),
+			configure: func(cfg *Config) { cfg.InputEncoding = charmap.Windows1252 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "week.csv")
+			if err := os.WriteFile(path, tt.file, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := Config{FieldMap: DefaultFieldMap()}
+			tt.configure(&cfg)
+
+			got, err := LoadWeekTemplate(path, cfg)
+			if err != nil {
+				t.Fatalf("LoadWeekTemplate() failed, %v", err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("LoadWeekTemplate() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
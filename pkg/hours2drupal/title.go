@@ -0,0 +1,90 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidTitleFormat is an error which is returned when a node title format can't build distinct titles.
+var ErrInvalidTitleFormat = errors.New("invalid title format")
+
+// FormatTitle builds a node title for the day from the format. A format without braces is a Go time layout,
+// like "January, 2006". A format with braces is a template, where the text in braces is a Go time layout
+// and the text around it is kept as it is, like "Hours - {January 2006}".
+func FormatTitle(day time.Time, format string) string {
+	if !strings.Contains(format, "{") {
+		return day.Format(format)
+	}
+
+	b := strings.Builder{}
+
+	for {
+		start := strings.Index(format, "{")
+		if start < 0 {
+			break
+		}
+
+		end := strings.Index(format[start:], "}")
+		if end < 0 {
+			break
+		}
+
+		b.WriteString(format[:start])
+		b.WriteString(day.Format(format[start+1 : start+end]))
+		format = format[start+end+1:]
+	}
+
+	b.WriteString(format)
+
+	return b.String()
+}
+
+// ValidateTitleFormat checks that the braces in the format are balanced, and that the format
+// builds different titles for different months and years, or weeks when grouping by week,
+// so days aren't grouped into the wrong node.
+func ValidateTitleFormat(format string, grouping Grouping) error {
+	depth := 0
+
+	for _, c := range format {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+
+		if depth < 0 || depth > 1 {
+			return fmt.Errorf("%w: '%v' has unbalanced braces", ErrInvalidTitleFormat, format)
+		}
+	}
+
+	if depth != 0 || strings.Contains(format, "{}") {
+		return fmt.Errorf("%w: '%v' has unbalanced or empty braces", ErrInvalidTitleFormat, format)
+	}
+
+	jan := time.Date(2025, time.January, 6, 0, 0, 0, 0, time.UTC)
+
+	others := []time.Time{jan.AddDate(0, 1, 0), jan.AddDate(1, 0, 0)}
+	layout := "January 2006"
+
+	if grouping == GroupByWeek {
+		others = append(others, jan.AddDate(0, 0, 7))
+		layout = "2006-01-02"
+	}
+
+	for _, other := range others {
+		if groupTitle(jan, format, grouping) == groupTitle(other, format, grouping) {
+			return fmt.Errorf("%w: '%v' builds the same title for %v and %v", ErrInvalidTitleFormat, format,
+				jan.Format(layout), other.Format(layout))
+		}
+	}
+
+	return nil
+}
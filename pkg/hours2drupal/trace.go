@@ -0,0 +1,57 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net/http/httptrace"
+	"time"
+)
+
+// requestTrace records the timings of the phases of one HTTP request.
+type requestTrace struct {
+	start, dnsStart, connectStart, tlsStart time.Time
+	dns, connect, tls, firstByte            time.Duration
+	reused                                  bool
+}
+
+// withTrace returns a context which records the timings of a request made with it, if tracing is enabled,
+// along with a function which logs the timings once the response has been received.
+func withTrace(ctx context.Context, cfg Config, method, url string) (context.Context, func()) {
+	if !cfg.Trace {
+		return ctx, func() {}
+	}
+
+	t := &requestTrace{start: time.Now()}
+
+	ct := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.dns = time.Since(t.dnsStart) },
+		ConnectStart: func(string, string) {
+			t.connectStart = time.Now()
+		},
+		ConnectDone: func(string, string, error) {
+			t.connect = time.Since(t.connectStart)
+		},
+		TLSHandshakeStart: func() { t.tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.tls = time.Since(t.tlsStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) { t.reused = info.Reused },
+		GotFirstResponseByte: func() {
+			t.firstByte = time.Since(t.start)
+		},
+	}
+
+	done := func() {
+		log.Printf("Trace: %v %v dns=%v connect=%v tls=%v ttfb=%v total=%v reused=%v\n",
+			method, url, t.dns, t.connect, t.tls, t.firstByte, time.Since(t.start), t.reused)
+	}
+
+	return httptrace.WithClientTrace(ctx, ct), done
+}
@@ -0,0 +1,203 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// contentHash returns a hash of the day's date and the values posted for it, so days can be compared
+// with the paragraphs already on the target without comparing each field.
+func contentHash(h DailyHours) string {
+	values := []string{h.Day.Format("2006-01-02"), h.Note, h.BuildingHours, h.ChatHours, strconv.FormatBool(h.Holiday),
+		h.Reference}
+
+	extras := []string{}
+	for field, value := range h.Extra {
+		extras = append(extras, field+"="+value)
+	}
+
+	sort.Strings(extras)
+
+	sum := sha256.Sum256([]byte(strings.Join(append(values, extras...), "\x00")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// fetchParagraphDay loads the paragraph from the target and returns the day it holds,
+// including the node its reference field points at.
+func fetchParagraphDay(ctx context.Context, cfg Config, id string) (DailyHours, error) {
+	u := fmt.Sprintf("%v%v/%v", cfg.BaseURL(), cfg.FieldMap.ParagraphPath, id)
+
+	p := struct {
+		Data struct {
+			Attributes    map[string]json.RawMessage `json:"attributes"`
+			Relationships map[string]struct {
+				Data *struct {
+					ID string `json:"id"`
+				} `json:"data"`
+			} `json:"relationships"`
+		} `json:"data"`
+	}{}
+
+	_, err := callAPI(ctx, cfg, u, http.MethodGet, &p, nil)
+	if err != nil {
+		return DailyHours{}, err
+	}
+
+	h, err := exportedDay(p.Data.Attributes, "", cfg)
+	if err != nil {
+		return DailyHours{}, fmt.Errorf("reading paragraph '%v' failed, %w", id, err)
+	}
+
+	if r, ok := p.Data.Relationships[cfg.FieldMap.ReferenceField]; ok && r.Data != nil {
+		h.Reference = r.Data.ID
+	}
+
+	return h, nil
+}
+
+// splitUnchanged compares the days with the paragraphs an existing node references.
+// It returns the relationships of the paragraphs which already match a day, keyed by the day they match,
+// the days which still need a paragraph, and the relationships which don't match any day.
+func splitUnchanged(ctx context.Context, cfg Config, rels []ParagraphRelationship,
+	days []DailyHours) (map[string]ParagraphRelationship, []DailyHours, []ParagraphRelationship, error) {
+	existing := map[string][]ParagraphRelationship{}
+	leftover := []ParagraphRelationship{}
+
+	for _, r := range rels {
+		// Only paragraphs of the hours by day type can match a day.
+		if r.Type != cfg.FieldMap.ParagraphType {
+			leftover = append(leftover, r)
+			continue
+		}
+
+		h, err := fetchParagraphDay(ctx, cfg, r.ID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		hash := contentHash(h)
+		existing[hash] = append(existing[hash], r)
+	}
+
+	kept := map[string]ParagraphRelationship{}
+	changed := []DailyHours{}
+
+	for _, h := range days {
+		// The reference is only posted when the field map has a reference field.
+		posted := h
+		if cfg.FieldMap.ReferenceField == "" {
+			posted.Reference = ""
+		}
+
+		hash := contentHash(posted)
+
+		if matches := existing[hash]; len(matches) > 0 {
+			kept[h.Day.Format("2006-01-02")] = matches[0]
+			existing[hash] = matches[1:]
+
+			continue
+		}
+
+		changed = append(changed, h)
+	}
+
+	for _, matches := range existing {
+		leftover = append(leftover, matches...)
+	}
+
+	return kept, changed, leftover, nil
+}
+
+// patchedParagraph is an existing paragraph which is patched with a day's hours.
+type patchedParagraph struct {
+	Relationship ParagraphRelationship
+	Day          DailyHours
+}
+
+// patch sends the selected fields of the day to the paragraph, and returns the relationship
+// to the paragraph's new revision.
+func (pp patchedParagraph) patch(ctx context.Context, nodeID string, cfg Config) (ParagraphRelationship, error) {
+	p := NewHoursByDayParagraph(nodeID, pp.Day, cfg.FieldMap)
+	p.Data.Type = pp.Relationship.Type
+	p.Data.ID = pp.Relationship.ID
+
+	err := p.Patch(ctx, cfg)
+	if err != nil {
+		return pp.Relationship, fmt.Errorf("patching paragraph '%v' failed, %w", p.Data.ID, err)
+	}
+
+	r := pp.Relationship
+	if p.Data.Attributes.DrupalInternalRevisionID != 0 {
+		r.Meta.TargetRevisionID = p.Data.Attributes.DrupalInternalRevisionID
+	}
+
+	return r, nil
+}
+
+// splitPatched matches the days with the paragraphs an existing node references for the same day.
+// It returns the paragraphs to patch, the days which still need a new paragraph, and the relationships
+// which don't match any day. If a day has more than one paragraph, the first is patched.
+func splitPatched(ctx context.Context, cfg Config, rels []ParagraphRelationship,
+	days []DailyHours) ([]patchedParagraph, []DailyHours, []ParagraphRelationship, error) {
+	existing := map[string][]ParagraphRelationship{}
+	leftover := []ParagraphRelationship{}
+
+	for _, r := range rels {
+		// Only paragraphs of the hours by day type can match a day.
+		if r.Type != cfg.FieldMap.ParagraphType {
+			leftover = append(leftover, r)
+			continue
+		}
+
+		h, err := fetchParagraphDay(ctx, cfg, r.ID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		day := h.Day.Format("2006-01-02")
+		existing[day] = append(existing[day], r)
+	}
+
+	patched := []patchedParagraph{}
+	created := []DailyHours{}
+
+	for _, h := range days {
+		day := h.Day.Format("2006-01-02")
+
+		if matches := existing[day]; len(matches) > 0 {
+			patched = append(patched, patchedParagraph{Relationship: matches[0], Day: h})
+			existing[day] = matches[1:]
+
+			continue
+		}
+
+		created = append(created, h)
+	}
+
+	for _, matches := range existing {
+		leftover = append(leftover, matches...)
+	}
+
+	return patched, created, leftover, nil
+}
+
+// sortRelationships orders the relationships by the day of the paragraph each references.
+// The days are the kept relationships' days and the created paragraphs' days, keyed by paragraph ID.
+func sortRelationships(rels []ParagraphRelationship, days map[string]string) {
+	sort.SliceStable(rels, func(i, j int) bool {
+		return days[rels[i].ID] < days[rels[j].ID]
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSplitUnchangedComparesReference(t *testing.T) {
+	fm := DefaultFieldMap()
+	fm.ReferenceField = "field_location"
+
+	// The existing paragraph references the library's main building.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeHeader)
+		fmt.Fprintf(w, `{"data":{"attributes":{%q:"2025-01-06",%q:"9-5",%q:"10-4"},`+
+			`"relationships":{%q:{"data":{"type":"node--page","id":"main-building"}}}}}`,
+			fm.Fields.Day, fm.Fields.BuildingHours, fm.Fields.ChatHours, fm.ReferenceField)
+	}))
+	defer s.Close()
+
+	cfg := testServerConfig(s)
+	cfg.FieldMap = fm
+
+	rels := []ParagraphRelationship{NewParagraphRelationship(fm.ParagraphType, "hours-6", 1)}
+	day := DailyHours{Day: time.Date(2025, time.January, 6, 12, 0, 0, 0, time.UTC), BuildingHours: "9-5", ChatHours: "10-4"}
+
+	tests := []struct {
+		name      string
+		reference string
+		kept      bool
+	}{
+		{name: "same reference", reference: "main-building", kept: true},
+		{name: "different reference", reference: "annex", kept: false},
+		{name: "no reference", reference: "", kept: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := day
+			h.Reference = tt.reference
+
+			kept, changed, leftover, err := splitUnchanged(context.Background(), cfg, rels, []DailyHours{h})
+			if err != nil {
+				t.Fatalf("splitUnchanged() failed, %v", err)
+			}
+
+			if got := len(kept) == 1 && len(changed) == 0 && len(leftover) == 0; got != tt.kept {
+				t.Errorf("splitUnchanged() kept %v, changed %v, and left %v, want kept %v", kept, changed, leftover, tt.kept)
+			}
+		})
+	}
+}
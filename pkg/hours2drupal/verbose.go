@@ -0,0 +1,48 @@
+// Copyright 2021 Carleton University Library.
+// All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE.txt file.
+
+package hours2drupal
+
+import (
+	"log"
+	"net/http"
+)
+
+// logVerbose logs the message, if Verbose is set.
+func logVerbose(cfg Config, format string, v ...interface{}) {
+	if !cfg.Verbose {
+		return
+	}
+
+	log.Printf(format, v...)
+}
+
+// logRequest logs the request's method, URL, headers, and body, if Verbose is set.
+// The Authorization and API key headers are always hidden, even when redaction is turned off.
+func logRequest(cfg Config, r *http.Request, body []byte) {
+	if !cfg.Verbose {
+		return
+	}
+
+	h := cfg.Redactor.RedactHeader(r.Header)
+	if h.Get("Authorization") != "" {
+		h.Set("Authorization", Redacted)
+	}
+
+	if cfg.APIKey != "" && h.Get(cfg.apiKeyHeader()) != "" {
+		h.Set(cfg.apiKeyHeader(), Redacted)
+	}
+
+	log.Printf("Request: %v %v\nHeaders: %v\nBody: %s\n", r.Method, r.URL, h, body)
+}
+
+// logResponse logs the response's status and body, if Verbose is set.
+func logResponse(cfg Config, r *http.Request, resp *http.Response, body []byte) {
+	if !cfg.Verbose {
+		return
+	}
+
+	log.Printf("Response: %v %v: %v\nBody: %s\n", r.Method, r.URL, resp.Status, cfg.Redactor.Redact(string(body)))
+}